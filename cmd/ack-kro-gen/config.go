@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+)
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect graphs.yaml",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "resolve [service...]",
+		Short: "Print the per-service config after defaults are merged",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			graphs := cfg.Graphs
+			if len(args) > 0 {
+				want := map[string]bool{}
+				for _, a := range args {
+					want[a] = true
+				}
+				graphs = nil
+				for _, g := range cfg.Graphs {
+					if want[g.Service] {
+						graphs = append(graphs, g)
+						delete(want, g.Service)
+					}
+				}
+				for svc := range want {
+					return fmt.Errorf("service %q not found in %s", svc, strings.Join(flagGraphs, ","))
+				}
+			}
+
+			enc := yaml.NewEncoder(os.Stdout)
+			enc.SetIndent(2)
+			defer enc.Close()
+			return enc.Encode(struct {
+				Graphs []config.GraphSpec `yaml:"graphs"`
+			}{graphs})
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema for graphs.yaml",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := config.SchemaJSON()
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(b)
+			return err
+		},
+	})
+	return cmd
+}
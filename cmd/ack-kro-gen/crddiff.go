@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+	"github.com/jayadeyemi/ack-kro-gen/internal/crddiff"
+	"github.com/jayadeyemi/ack-kro-gen/internal/helmfetch"
+	"github.com/jayadeyemi/ack-kro-gen/internal/render"
+)
+
+func newCRDDiffCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "crd-diff <service> <oldVersion> <newVersion>",
+		Short: "Compare a service's CRDs between two chart versions and fail on breaking changes",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc := args[0]
+			var sets [2]crddiff.Set
+			for i, version := range args[1:] {
+				gs := config.GraphSpec{Service: svc, Version: version}
+				chartPath, err := helmfetch.EnsureChart(context.Background(), chartRefFor(gs), flagCache, flagOffline)
+				if err != nil {
+					return fmt.Errorf("fetch chart for %s %s: %w", svc, version, err)
+				}
+				ch, err := render.LoadChart(context.Background(), chartPath)
+				if err != nil {
+					return err
+				}
+				if sets[i], err = crddiff.FromChart(ch); err != nil {
+					return fmt.Errorf("%s %s: %w", svc, version, err)
+				}
+			}
+
+			changes := crddiff.Compare(sets[0], sets[1])
+			if len(changes) == 0 {
+				fmt.Println("no CRD changes")
+				return nil
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "IMPACT\tCRD\tVERSION\tPATH\tCHANGE")
+			for _, c := range changes {
+				impact := "compatible"
+				if c.Breaking {
+					impact = "BREAKING"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", impact, c.CRD, orDash(c.Version), orDash(c.Path), c.Message)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			if n := crddiff.Breaking(changes); n > 0 {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("%s %s -> %s: %d breaking CRD changes", svc, args[1], args[2], n)
+			}
+			return nil
+		},
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -24,12 +24,17 @@ import (
 )
 
 var (
-	flagGraphs      string
-	flagOut         string
-	flagCache       string
-	flagOffline     bool
-	flagConcurrency int
-	flagLogLevel    string
+	flagGraphs         []string
+	flagEnv            string
+	flagOut            string
+	flagCache          string
+	flagOffline        bool
+	flagConcurrency    int
+	flagLogLevel       string
+	flagSet            []string
+	flagTimeout        time.Duration
+	flagServiceTimeout time.Duration
+	flagDumpRendered   string
 )
 
 func main() {
@@ -37,11 +42,11 @@ func main() {
 		Use:   "ack-kro-gen",
 		Short: "Generate KRO RGDs for AWS ACK controllers",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if flagGraphs == "" || flagOut == "" || flagCache == "" {
+			if len(flagGraphs) == 0 || flagOut == "" || flagCache == "" {
 				return errors.New("--graphs, --out, and --charts-cache are required")
 			}
 
-			log.Printf("start: graphs=%s out=%s cache=%s offline=%v concurrency=%d", flagGraphs, flagOut, flagCache, flagOffline, flagConcurrency)
+			log.Printf("start: graphs=%s env=%s out=%s cache=%s offline=%v concurrency=%d", strings.Join(flagGraphs, ","), flagEnv, flagOut, flagCache, flagOffline, flagConcurrency)
 
 			absOut, err := filepath.Abs(flagOut)
 			if err != nil {
@@ -51,38 +56,62 @@ func main() {
 				return fmt.Errorf("create out dir: %w", err)
 			}
 
-			cfg, err := config.Load(flagGraphs)
+			cfg, err := loadConfig()
 			if err != nil {
 				return err
 			}
 
-			ctx, cancel := context.WithTimeout(context.Background(), 60*time.Minute)
+			runCtx, cancel := context.WithTimeout(context.Background(), flagTimeout)
 			defer cancel()
 
 			start := time.Now()
 			sem := make(chan struct{}, flagConcurrency)
-			g, ctx := errgroup.WithContext(ctx)
+			g, ctx := errgroup.WithContext(runCtx)
 
 			for _, gspec := range cfg.Graphs {
 				gs := gspec // capture
 				g.Go(func() error {
-					sem <- struct{}{}
+					select {
+					case sem <- struct{}{}:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
 					defer func() { <-sem }()
 
-					chartRef := fmt.Sprintf("oci://public.ecr.aws/aws-controllers-k8s/%s-chart:%s", gs.Service, gs.Version)
+					// The per-service budget starts once the service holds a worker slot.
+					ctx, cancel := serviceContext(ctx)
+					defer cancel()
+					stageErr := func(stage string, err error) error {
+						return stageError(runCtx, ctx, gs.Service, stage, err)
+					}
+
+					chartRef := chartRefFor(gs)
 					log.Printf("[%s] fetch: ref=%s", gs.Service, chartRef)
 					chartPath, err := helmfetch.EnsureChart(ctx, chartRef, flagCache, flagOffline)
 					if err != nil {
-						return fmt.Errorf("fetch chart for %s: %w", gs.Service, err)
+						return stageErr("fetch", err)
 					}
 					log.Printf("[%s] fetch: cached at %s", gs.Service, chartPath)
 
+					ch, err := render.LoadChart(ctx, chartPath)
+					if err != nil {
+						return stageErr("load", err)
+					}
+
 					log.Printf("[%s] render: begin", gs.Service)
-					r, err := render.RenderChart(ctx, chartPath, gs)
+					r, err := render.Render(ctx, ch, gs)
 					if err != nil {
-						return fmt.Errorf("render %s: %w", gs.Service, err)
+						return stageErr("render", err)
 					}
 					log.Printf("[%s] render: crds=%d files=%d", gs.Service, len(r.CRDs), len(r.RenderedFiles))
+					if flagDumpRendered != "" {
+						dumped, err := r.Dump(filepath.Join(flagDumpRendered, gs.Service))
+						if err != nil {
+							return stageErr("render", err)
+						}
+						log.Printf("[%s] render: dumped %d files to %s", gs.Service, len(dumped), filepath.Join(flagDumpRendered, gs.Service))
+					}
+					gs.ApplyChartDefaults(r.AppVersion)
 
 					// Quick preview of first few manifest doc kinds for visibility
 					firstKinds := []string{}
@@ -107,9 +136,9 @@ func main() {
 
 					// Write separate CRD and controller graphs named from their RGD metadata.name
 					log.Printf("[%s] emit: begin", gs.Service)
-					wrote, err := kro.EmitRGDs(gs, r, absOut)
+					wrote, err := kro.EmitRGDs(ctx, gs, r, absOut)
 					if err != nil {
-						return fmt.Errorf("emit rgds for %s: %w", gs.Service, err)
+						return stageErr("emit", err)
 					}
 					for _, f := range wrote {
 						fi, _ := os.Stat(f)
@@ -131,12 +160,22 @@ func main() {
 		},
 	}
 
-	root.Flags().StringVar(&flagGraphs, "graphs", "graphs.yaml", "graphs.yaml path")
+	root.PersistentFlags().StringSliceVar(&flagGraphs, "graphs", []string{"graphs.yaml"}, "graphs.yaml paths, merged in order (repeat or comma-separate)")
+	root.PersistentFlags().StringVar(&flagEnv, "env", "", "apply the named entry from the overlays block")
 	root.Flags().StringVar(&flagOut, "out", "out", "output directory")
-	root.Flags().StringVar(&flagCache, "charts-cache", ".cache/charts", "local chart cache directory")
-	root.Flags().BoolVar(&flagOffline, "offline", false, "offline mode, read charts only from cache")
+	root.PersistentFlags().StringVar(&flagCache, "charts-cache", ".cache/charts", "local chart cache directory")
+	root.PersistentFlags().BoolVar(&flagOffline, "offline", false, "offline mode, read charts only from cache")
+	root.PersistentFlags().StringArrayVar(&flagSet, "set", nil, "chart value override applied to every graph (key=value, helm --set syntax; repeatable)")
 	root.Flags().IntVar(&flagConcurrency, "concurrency", max(2, runtime.NumCPU()), "parallel services")
 	root.Flags().StringVar(&flagLogLevel, "log-level", "info", "log level: info|debug")
+	root.Flags().DurationVar(&flagTimeout, "timeout", 60*time.Minute, "overall time limit for the run")
+	root.Flags().StringVar(&flagDumpRendered, "dump-rendered", "", "write each service's rendered CRDs and templates under this directory (<dir>/<service>/...) for debugging")
+	root.Flags().DurationVar(&flagServiceTimeout, "service-timeout", 0, "time limit per service across fetch, load, render and emit (0 = no limit)")
+
+	root.AddCommand(newConfigCmd())
+	root.AddCommand(newValuesCmd())
+	root.AddCommand(newRBACCmd())
+	root.AddCommand(newCRDDiffCmd())
 
 	if err := root.Execute(); err != nil {
 		if !strings.HasSuffix(err.Error(), "help requested") {
@@ -145,6 +184,43 @@ func main() {
 	}
 }
 
+// loadConfig loads --graphs with the --env overlay and appends --set
+// overrides to every graph.
+func loadConfig() (*config.Root, error) {
+	cfg, err := config.LoadFiles(flagGraphs, flagEnv)
+	if err != nil {
+		return nil, err
+	}
+	for i := range cfg.Graphs {
+		cfg.Graphs[i].Set = append(cfg.Graphs[i].Set, flagSet...)
+	}
+	return cfg, nil
+}
+
+// serviceContext derives the per-service context, bounded by --service-timeout when set.
+func serviceContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if flagServiceTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, flagServiceTimeout)
+}
+
+// stageError wraps a stage failure with the stage and service names. When a
+// deadline caused it, the message says which limit was exceeded.
+func stageError(runCtx, svcCtx context.Context, service, stage string, err error) error {
+	switch {
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("[%s] %s: timed out (--timeout=%s): %w", service, stage, flagTimeout, err)
+	case errors.Is(svcCtx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("[%s] %s: timed out (--service-timeout=%s): %w", service, stage, flagServiceTimeout, err)
+	}
+	return fmt.Errorf("[%s] %s: %w", service, stage, err)
+}
+
+func chartRefFor(gs config.GraphSpec) string {
+	return fmt.Sprintf("oci://public.ecr.aws/aws-controllers-k8s/%s-chart:%s", gs.Service, gs.Version)
+}
+
 func max(a, b int) int {
 	if a > b {
 		return a
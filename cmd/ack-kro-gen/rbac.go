@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+	"github.com/jayadeyemi/ack-kro-gen/internal/helmfetch"
+	"github.com/jayadeyemi/ack-kro-gen/internal/kro"
+	"github.com/jayadeyemi/ack-kro-gen/internal/rbac"
+	"github.com/jayadeyemi/ack-kro-gen/internal/render"
+)
+
+func newRBACCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rbac",
+		Short: "Review the RBAC rules each service's controller is granted",
+	}
+	var from string
+	report := &cobra.Command{
+		Use:   "report [service...]",
+		Short: "Print the verb matrix per API group and resource, flagging wildcards and secrets access",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			services := args
+			if len(services) == 0 {
+				if from != "" {
+					var err error
+					if services, err = treeServices(from); err != nil {
+						return err
+					}
+				} else {
+					cfg, err := loadConfig()
+					if err != nil {
+						return err
+					}
+					for _, gs := range cfg.Graphs {
+						services = append(services, gs.Service)
+					}
+				}
+			}
+			first := true
+			for _, svc := range services {
+				var variants []rbac.Variant
+				var err error
+				if from != "" {
+					variants, err = treeVariants(from, svc)
+				} else {
+					variants, err = chartVariants(svc, "")
+				}
+				if err != nil {
+					return err
+				}
+				for _, v := range variants {
+					if !first {
+						fmt.Println()
+					}
+					first = false
+					fmt.Printf("# %s%s\n", svc, whenSuffix(v.When))
+					if err := rbac.Write(os.Stdout, v.Matrix); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+	report.Flags().StringVar(&from, "from", "", "read the generated RGDs under this output directory instead of rendering the charts")
+
+	diff := &cobra.Command{
+		Use:   "diff <service> <old> <new>",
+		Short: "Show the RBAC changes between two chart versions or two output directories",
+		Long: "Show the RBAC changes between two chart versions or two output directories.\n" +
+			"An argument naming an existing directory is read as an output tree; anything\n" +
+			"else is a chart version, rendered with the service's settings from graphs.yaml.\n" +
+			"Variants an output tree selects with includeWhen are compared one by one.",
+		Args: cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc := args[0]
+			var sides [2][]rbac.Variant
+			for i, arg := range args[1:] {
+				var err error
+				if fi, statErr := os.Stat(arg); statErr == nil && fi.IsDir() {
+					sides[i], err = treeVariants(arg, svc)
+				} else {
+					sides[i], err = chartVariants(svc, arg)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			pairs := pairVariants(sides[0], sides[1])
+			for i, p := range pairs {
+				if len(pairs) > 1 {
+					if i > 0 {
+						fmt.Println()
+					}
+					fmt.Printf("# %s%s\n", svc, whenSuffix(p.when))
+				}
+				changes := rbac.Diff(p.before, p.after)
+				if len(changes) == 0 {
+					fmt.Println("no RBAC changes")
+					continue
+				}
+				if err := rbac.WriteDiff(os.Stdout, changes); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(report, diff)
+	return cmd
+}
+
+// chartVariants renders the chart for service, at version if set, and
+// aggregates its RBAC group. Charts have no includeWhen, so there is a single
+// variant.
+func chartVariants(service, version string) ([]rbac.Variant, error) {
+	gs, err := graphFor(service)
+	if err != nil {
+		return nil, err
+	}
+	if version != "" {
+		gs.Version = version
+	}
+	ctx := context.Background()
+	chartPath, err := helmfetch.EnsureChart(ctx, chartRefFor(gs), flagCache, flagOffline)
+	if err != nil {
+		return nil, fmt.Errorf("fetch chart for %s: %w", gs.Service, err)
+	}
+	r, err := render.RenderChart(ctx, chartPath, gs)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] render: %w", gs.Service, err)
+	}
+	objs, err := kro.Objects(r)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %w", gs.Service, err)
+	}
+	m, err := rbac.FromObjects(classify.Classify(objs).RBAC)
+	if err != nil {
+		return nil, err
+	}
+	return []rbac.Variant{{Matrix: m}}, nil
+}
+
+// treeVariants aggregates the RBAC group of the controller RGD generated for
+// service under dir, which may be the --out directory or its ack/ subdirectory,
+// once per variant its includeWhen conditions select.
+func treeVariants(dir, service string) ([]rbac.Variant, error) {
+	path := filepath.Join(dir, "ack", service+"-ctrl.yaml")
+	if _, err := os.Stat(path); err != nil {
+		path = filepath.Join(dir, service+"-ctrl.yaml")
+	}
+	objs, when, err := kro.ReadObjects(path)
+	if err != nil {
+		return nil, err
+	}
+	return rbac.Variants(classify.Classify(objs).RBAC, when)
+}
+
+// variantPair is one comparison rbac diff prints.
+type variantPair struct {
+	when          []string
+	before, after rbac.Matrix
+}
+
+// pairVariants matches the variants of two sides by their conditions. A side
+// with a single unconditional variant, such as a rendered chart, is compared
+// with every variant of the other; a variant missing from a side compares
+// with nothing granted.
+func pairVariants(before, after []rbac.Variant) []variantPair {
+	single := func(vs []rbac.Variant) bool { return len(vs) == 1 && len(vs[0].When) == 0 }
+	var pairs []variantPair
+	switch {
+	case single(before):
+		for _, v := range after {
+			pairs = append(pairs, variantPair{when: v.When, before: before[0].Matrix, after: v.Matrix})
+		}
+		return pairs
+	case single(after):
+		for _, v := range before {
+			pairs = append(pairs, variantPair{when: v.When, before: v.Matrix, after: after[0].Matrix})
+		}
+		return pairs
+	}
+	key := func(v rbac.Variant) string { return strings.Join(v.When, " && ") }
+	befores := map[string]rbac.Matrix{}
+	for _, v := range before {
+		befores[key(v)] = v.Matrix
+	}
+	seen := map[string]bool{}
+	for _, v := range after {
+		seen[key(v)] = true
+		pairs = append(pairs, variantPair{when: v.When, before: befores[key(v)], after: v.Matrix})
+	}
+	for _, v := range before {
+		if !seen[key(v)] {
+			pairs = append(pairs, variantPair{when: v.When, before: v.Matrix})
+		}
+	}
+	return pairs
+}
+
+// whenSuffix describes includeWhen conditions in a report heading.
+func whenSuffix(when []string) string {
+	if len(when) == 0 {
+		return ""
+	}
+	return " when " + strings.Join(when, " && ")
+}
+
+// treeServices lists the services with a controller RGD under dir.
+func treeServices(dir string) ([]string, error) {
+	var services []string
+	for _, pattern := range []string{filepath.Join(dir, "ack", "*-ctrl.yaml"), filepath.Join(dir, "*-ctrl.yaml")} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			services = append(services, strings.TrimSuffix(filepath.Base(m), "-ctrl.yaml"))
+		}
+		if len(services) > 0 {
+			return services, nil
+		}
+	}
+	return nil, fmt.Errorf("no controller RGDs found under %s", dir)
+}
+
+func graphFor(service string) (config.GraphSpec, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return config.GraphSpec{}, err
+	}
+	for _, gs := range cfg.Graphs {
+		if gs.Service == service {
+			return gs, nil
+		}
+	}
+	return config.GraphSpec{}, fmt.Errorf("service %q not found in %s", service, strings.Join(flagGraphs, ","))
+}
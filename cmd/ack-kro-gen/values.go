@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/helmfetch"
+	"github.com/jayadeyemi/ack-kro-gen/internal/render"
+)
+
+func newValuesCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "values <service>",
+		Short: "Print the final chart values for a service and where each key came from",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			for _, gs := range cfg.Graphs {
+				if gs.Service != args[0] {
+					continue
+				}
+				ctx := context.Background()
+				chartPath, err := helmfetch.EnsureChart(ctx, chartRefFor(gs), flagCache, flagOffline)
+				if err != nil {
+					return fmt.Errorf("fetch chart for %s: %w", gs.Service, err)
+				}
+				vals, err := render.ExplainValues(ctx, chartPath, gs)
+				if err != nil {
+					return err
+				}
+				tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(tw, "PATH\tVALUE\tSOURCE")
+				for _, v := range vals {
+					fmt.Fprintf(tw, "%s\t%s\t%s\n", v.Path, render.FormatValue(v.Value), v.Source)
+				}
+				return tw.Flush()
+			}
+			return fmt.Errorf("service %q not found in %s", args[0], strings.Join(flagGraphs, ","))
+		},
+	}
+}
@@ -1,10 +1,16 @@
 package classify
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 
+	"github.com/jayadeyemi/ack-kro-gen/internal/util"
 	"gopkg.in/yaml.v3"
 )
 
@@ -13,57 +19,323 @@ type Obj struct {
 	Kind       string
 	Name       string
 	Namespace  string
-	RawYAML    string
+	// Hooks lists the Helm hook phases from the helm.sh/hook annotation, if any.
+	Hooks []string
+	// HookWeight is the helm.sh/hook-weight annotation, used to order hooks.
+	HookWeight int
+	// Source is where the object was rendered from.
+	Source Source
+	// Node is the object's mapping node. It is decoded once, without comments,
+	// and carried through every later stage instead of re-parsing text.
+	Node *yaml.Node
 }
 
+// YAML encodes the object for consumers that need text, such as exec plugins.
+func (o Obj) YAML() (string, error) {
+	var b strings.Builder
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(o.Node); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Source locates a document in the rendered output: the template or CRD file
+// path, the document's index within that file and the line it starts on.
+type Source struct {
+	File  string
+	Index int
+	Line  int
+}
+
+func (s Source) String() string {
+	if s.File == "" {
+		return "<unknown source>"
+	}
+	return fmt.Sprintf("%s (document %d, line %d)", s.File, s.Index, s.Line)
+}
+
+// ParseDoc parses one document of file, as split by util.SplitDocs, and
+// records it as the object's Source. Errors name the file, document and line,
+// give YAML line numbers relative to the whole file and quote the lines around
+// the problem.
+func ParseDoc(file string, d util.Doc) (Obj, error) {
+	src := Source{File: file, Index: d.Index, Line: d.Line}
+	if d.Node != nil {
+		// Already decoded by the splitter, with lines relative to the file.
+		o, err := FromNode(d.Node)
+		if err != nil {
+			return Obj{}, fmt.Errorf("%s: %w", src, err)
+		}
+		o.Source = src
+		return o, nil
+	}
+	o, err := Parse(d.Text)
+	if err != nil {
+		msg := shiftLines(err.Error(), d.Line-1)
+		if m := errLine.FindStringSubmatch(err.Error()); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			msg += excerpt(d.Text, n, d.Line)
+		}
+		return Obj{}, fmt.Errorf("%s: %s", src, msg)
+	}
+	o.Source = src
+	return o, nil
+}
+
+// excerpt quotes the lines of text around line (1-based within text), numbered
+// as lines of the file text starts on line first of.
+func excerpt(text string, line, first int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	var b strings.Builder
+	for i := max(line-2, 1); i <= min(line+1, len(lines)); i++ {
+		mark := " "
+		if i == line {
+			mark = ">"
+		}
+		fmt.Fprintf(&b, "\n  %s %4d | %s", mark, i+first-1, lines[i-1])
+	}
+	return b.String()
+}
+
+var errLine = regexp.MustCompile(`\bline (\d+)`)
+
+// shiftLines adds delta to every "line N" in a YAML error message.
+func shiftLines(msg string, delta int) string {
+	return errLine.ReplaceAllStringFunc(msg, func(m string) string {
+		n, _ := strconv.Atoi(m[len("line "):])
+		return fmt.Sprintf("line %d", n+delta)
+	})
+}
+
+// Groups holds classified objects in emit order. Which objects land in which
+// group, and their order within it, is decided by a Rules table.
 type Groups struct {
-	CRDs        []Obj
-	Core        []Obj // ServiceAccount, Service, ConfigMap, Namespace
-	RBAC        []Obj // ClusterRole, Role, ClusterRoleBinding, RoleBinding
-	Deployments []Obj // Deployments
-	Others      []Obj // any leftover kinds
+	CRDs      []Obj
+	Core      []Obj // namespaces, service accounts, secrets, config maps, services, leases
+	RBAC      []Obj // roles and bindings
+	Workloads []Obj // deployments, stateful sets, daemon sets, jobs
+	Others    []Obj // everything else, e.g. PDBs, network policies, webhooks
 }
 
+// Parse decodes a single YAML document into an Obj. A second document in doc
+// is an error rather than being silently ignored.
 func Parse(doc string) (Obj, error) {
-	var m map[string]any
-	if err := yaml.Unmarshal([]byte(doc), &m); err != nil {
+	var n yaml.Node
+	dec := yaml.NewDecoder(strings.NewReader(doc))
+	if err := dec.Decode(&n); err != nil {
+		if err == io.EOF {
+			return Obj{}, errors.New("empty document")
+		}
 		return Obj{}, err
 	}
-	apiv, _ := m["apiVersion"].(string)
-	kind, _ := m["kind"].(string)
-	md, _ := m["metadata"].(map[string]any)
-	name, _ := md["name"].(string)
-	ns, _ := md["namespace"].(string)
-	return Obj{APIVersion: apiv, Kind: kind, Name: name, Namespace: ns, RawYAML: strings.TrimSpace(doc) + "\n"}, nil
+	var extra yaml.Node
+	if err := dec.Decode(&extra); err != io.EOF {
+		if err != nil {
+			return Obj{}, err
+		}
+		return Obj{}, fmt.Errorf("line %d: unexpected second document", extra.Line)
+	}
+	return FromNode(&n)
 }
 
-func Classify(objs []Obj) Groups {
-	g := Groups{}
-	for _, o := range objs {
-		if strings.HasPrefix(o.APIVersion, "apiextensions.k8s.io/") && o.Kind == "CustomResourceDefinition" {
-			g.CRDs = append(g.CRDs, o); continue
-		}
-		switch o.Kind {
-		case "ServiceAccount", "Service", "ConfigMap", "Namespace":
-			g.Core = append(g.Core, o)
-		case "ClusterRole", "Role", "ClusterRoleBinding", "RoleBinding":
-			g.RBAC = append(g.RBAC, o)
-		case "Deployment":
-			g.Deployments = append(g.Deployments, o)
+// FromNode builds an Obj around a decoded document or mapping node, which it
+// takes ownership of. Comments and styles are dropped, aliases and merge keys
+// are expanded, duplicate keys are rejected and keys are sorted, matching
+// what decoding into a map and encoding it again would do.
+func FromNode(n *yaml.Node) (Obj, error) {
+	if n.Kind == yaml.DocumentNode && len(n.Content) == 1 {
+		n = n.Content[0]
+	}
+	if n.Kind != yaml.MappingNode {
+		return Obj{}, fmt.Errorf("line %d: document is a %s, not a mapping", n.Line, n.ShortTag())
+	}
+	if err := cleanNode(n); err != nil {
+		return Obj{}, err
+	}
+	md := util.MappingValue(n, "metadata")
+	o := Obj{
+		APIVersion: scalar(util.MappingValue(n, "apiVersion")),
+		Kind:       scalar(util.MappingValue(n, "kind")),
+		Name:       scalar(util.MappingValue(md, "name")),
+		Namespace:  scalar(util.MappingValue(md, "namespace")),
+		Node:       n,
+	}
+	ann := util.MappingValue(md, "annotations")
+	if h := scalar(util.MappingValue(ann, "helm.sh/hook")); h != "" {
+		for _, phase := range strings.Split(h, ",") {
+			if phase = strings.TrimSpace(phase); phase != "" {
+				o.Hooks = append(o.Hooks, phase)
+			}
+		}
+	}
+	if w := scalar(util.MappingValue(ann, "helm.sh/hook-weight")); w != "" {
+		o.HookWeight, _ = strconv.Atoi(strings.TrimSpace(w))
+	}
+	return o, nil
+}
+
+// cleanNode strips comments and source styles (quoting, flow collections)
+// below n, so objects encode uniformly whatever template produced them. Like
+// decoding into a map, it expands aliases and merge keys, reports the first
+// duplicate mapping key and orders keys the way encoding a map sorts them.
+func cleanNode(n *yaml.Node) error {
+	n.HeadComment, n.LineComment, n.FootComment = "", "", ""
+	n.Style = 0
+	n.Anchor = ""
+	for i, c := range n.Content {
+		if c.Kind == yaml.AliasNode {
+			n.Content[i] = util.CloneNode(c.Alias)
+		}
+	}
+	for _, c := range n.Content {
+		if err := cleanNode(c); err != nil {
+			return err
+		}
+	}
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	if err := expandMerges(n); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k := n.Content[i]
+		if k.Kind == yaml.ScalarNode {
+			if seen[k.Value] {
+				return fmt.Errorf("line %d: mapping key %q already defined", k.Line, k.Value)
+			}
+			seen[k.Value] = true
+		}
+	}
+	sortKeys(n)
+	return nil
+}
+
+// expandMerges replaces << merge keys in mapping m with the keys they merge
+// in. Keys set explicitly win, then earlier merged mappings over later ones.
+func expandMerges(m *yaml.Node) error {
+	var keep, merged []*yaml.Node
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		k, v := m.Content[i], m.Content[i+1]
+		if k.Kind != yaml.ScalarNode || k.ShortTag() != "!!merge" {
+			keep = append(keep, k, v)
+			continue
+		}
+		switch v.Kind {
+		case yaml.MappingNode:
+			merged = append(merged, v.Content...)
+		case yaml.SequenceNode:
+			for _, item := range v.Content {
+				if item.Kind != yaml.MappingNode {
+					return fmt.Errorf("line %d: merge key value is not a mapping", item.Line)
+				}
+				merged = append(merged, item.Content...)
+			}
 		default:
-			g.Others = append(g.Others, o)
-		}
-	}
-	// Deterministic order within groups
-	less := func(a, b Obj) bool {
-		ka := fmt.Sprintf("%s/%s/%s", a.Kind, a.Namespace, a.Name)
-		kb := fmt.Sprintf("%s/%s/%s", b.Kind, b.Namespace, b.Name)
-		return ka < kb
-	}
-	sort.Slice(g.CRDs, func(i, j int) bool { return less(g.CRDs[i], g.CRDs[j]) })
-	sort.Slice(g.Core, func(i, j int) bool { return less(g.Core[i], g.Core[j]) })
-	sort.Slice(g.RBAC, func(i, j int) bool { return less(g.RBAC[i], g.RBAC[j]) })
-	sort.Slice(g.Deployments, func(i, j int) bool { return less(g.Deployments[i], g.Deployments[j]) })
-	sort.Slice(g.Others, func(i, j int) bool { return less(g.Others[i], g.Others[j]) })
-	return g
-}
\ No newline at end of file
+			return fmt.Errorf("line %d: merge key value is not a mapping", v.Line)
+		}
+	}
+	if merged == nil {
+		return nil
+	}
+	have := make(map[string]bool, len(keep)/2)
+	for i := 0; i < len(keep); i += 2 {
+		have[keep[i].Value] = true
+	}
+	for i := 0; i+1 < len(merged); i += 2 {
+		if !have[merged[i].Value] {
+			have[merged[i].Value] = true
+			keep = append(keep, merged[i], merged[i+1])
+		}
+	}
+	m.Content = keep
+	return nil
+}
+
+// sortKeys orders the pairs of mapping m by key, using the order yaml.v3
+// gives a map's string keys when encoding it.
+func sortKeys(m *yaml.Node) {
+	n := len(m.Content) / 2
+	if n <= 1 {
+		return
+	}
+	for i := 0; i < n; i++ {
+		if m.Content[2*i].Kind != yaml.ScalarNode {
+			return
+		}
+	}
+	pairs := make([][2]*yaml.Node, n)
+	for i := range pairs {
+		pairs[i] = [2]*yaml.Node{m.Content[2*i], m.Content[2*i+1]}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return keyLess(pairs[i][0].Value, pairs[j][0].Value) })
+	for i, p := range pairs {
+		m.Content[2*i], m.Content[2*i+1] = p[0], p[1]
+	}
+}
+
+// keyLess reports whether map key a sorts before b when yaml.v3 encodes a
+// map. It mirrors yaml.v3's keyList.Less for strings: letters sort before
+// other characters, and runs of digits compare by their numeric value.
+func keyLess(a, b string) bool {
+	ar, br := []rune(a), []rune(b)
+	digits := false
+	for i := 0; i < len(ar) && i < len(br); i++ {
+		if ar[i] == br[i] {
+			digits = unicode.IsDigit(ar[i])
+			continue
+		}
+		al := unicode.IsLetter(ar[i])
+		bl := unicode.IsLetter(br[i])
+		if al && bl {
+			return ar[i] < br[i]
+		}
+		if al || bl {
+			if digits {
+				return al
+			}
+			return bl
+		}
+		var ai, bi int
+		var an, bn int64
+		if ar[i] == '0' || br[i] == '0' {
+			for j := i - 1; j >= 0 && unicode.IsDigit(ar[j]); j-- {
+				if ar[j] != '0' {
+					an, bn = 1, 1
+					break
+				}
+			}
+		}
+		for ai = i; ai < len(ar) && unicode.IsDigit(ar[ai]); ai++ {
+			an = an*10 + int64(ar[ai]-'0')
+		}
+		for bi = i; bi < len(br) && unicode.IsDigit(br[bi]); bi++ {
+			bn = bn*10 + int64(br[bi]-'0')
+		}
+		if an != bn {
+			return an < bn
+		}
+		if ai != bi {
+			return ai < bi
+		}
+		return ar[i] < br[i]
+	}
+	return len(ar) < len(br)
+}
+
+// scalar returns the value of a non-null scalar node, or "".
+func scalar(n *yaml.Node) string {
+	if n == nil || n.Kind != yaml.ScalarNode || n.ShortTag() == "!!null" {
+		return ""
+	}
+	return n.Value
+}
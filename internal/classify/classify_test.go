@@ -1,6 +1,12 @@
 package classify
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/util"
+	"gopkg.in/yaml.v3"
+)
 
 func TestClassifyOrder(t *testing.T) {
 	crd := `apiVersion: apiextensions.k8s.io/v1
@@ -31,7 +37,139 @@ metadata:
 		objs = append(objs, o)
 	}
 	g := Classify(objs)
-	if len(g.CRDs) != 1 || len(g.Core) != 1 || len(g.RBAC) != 1 || len(g.Deployments) != 1 {
+	if len(g.CRDs) != 1 || len(g.Core) != 1 || len(g.RBAC) != 1 || len(g.Workloads) != 1 {
 		t.Fatalf("unexpected grouping: %+v", g)
 	}
-}
\ No newline at end of file
+}
+
+func TestParseDocReportsStreamLines(t *testing.T) {
+	stream := "---\n# Source: chart/templates/sa.yaml\nkind: ServiceAccount\nmetadata:\n  name: s\n---\n# Source: chart/templates/cm.yaml\nkind: ConfigMap\nmetadata:\n  name: [c\n"
+	docs := util.SplitDocs(stream)
+	if len(docs) != 2 {
+		t.Fatalf("got %d docs, want 2", len(docs))
+	}
+	if _, err := ParseDoc("chart/templates/all.yaml", docs[0]); err != nil {
+		t.Fatal(err)
+	}
+	_, local := Parse(docs[1].Text)
+	_, err := ParseDoc("chart/templates/all.yaml", docs[1])
+	if local == nil || err == nil {
+		t.Fatalf("expected parse errors, got %v and %v", local, err)
+	}
+	// The YAML line inside the document is shifted by the 6 lines before it.
+	want := "chart/templates/all.yaml (document 1, line 7): " + strings.Replace(local.Error(), "line 3", "line 9", 1)
+	if !strings.HasPrefix(err.Error(), want+"\n") || !strings.Contains(err.Error(), ">    9 | metadata:") {
+		t.Fatalf("got %q, want %q", err, want)
+	}
+}
+
+func TestParseMatchesMapEncoding(t *testing.T) {
+	doc := `kind: ConfigMap
+metadata:
+  name: c
+  labels: &labels {b: "2", a: "1"}
+apiVersion: v1
+data:
+  <<: {z: merged, a: merged}
+  a: explicit
+  k10: x
+  k9: x
+  k010: x
+  k1a: x
+  k1-b: x
+  Z: x
+  _u: x
+  é: x
+copy: *labels
+`
+	got, err := parseObjs(t, doc)[0].YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := yaml.Unmarshal([]byte(doc), &m); err != nil {
+		t.Fatal(err)
+	}
+	var want strings.Builder
+	enc := yaml.NewEncoder(&want)
+	enc.SetIndent(2)
+	if err := enc.Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	if got != want.String() {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want.String())
+	}
+}
+
+func TestRulesOrderAndOverride(t *testing.T) {
+	objs := parseObjs(t,
+		"apiVersion: admissionregistration.k8s.io/v1\nkind: ValidatingWebhookConfiguration\nmetadata:\n  name: w\n",
+		"apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: x\n",
+		"apiVersion: policy/v1\nkind: PodDisruptionBudget\nmetadata:\n  name: p\n",
+		"apiVersion: v1\nkind: Service\nmetadata:\n  name: s\n",
+		"apiVersion: v1\nkind: Secret\nmetadata:\n  name: s\n",
+		"apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: s\n",
+	)
+	kinds := func(list []Obj) string {
+		var ks []string
+		for _, o := range list {
+			ks = append(ks, o.Kind)
+		}
+		return strings.Join(ks, ",")
+	}
+
+	g := Classify(objs)
+	if got, want := kinds(g.Core), "ServiceAccount,Secret,Service"; got != want {
+		t.Errorf("core = %s, want %s", got, want)
+	}
+	if got, want := kinds(g.Others), "PodDisruptionBudget,ValidatingWebhookConfiguration,Widget"; got != want {
+		t.Errorf("others = %s, want %s", got, want)
+	}
+
+	rules := append(Rules{{APIGroup: "example.com", Group: GroupCore, Weight: 15}}, DefaultRules...)
+	g = rules.Classify(objs)
+	if got, want := kinds(g.Core), "ServiceAccount,Widget,Secret,Service"; got != want {
+		t.Errorf("core with extra rule = %s, want %s", got, want)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	cm := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: c\n  namespace: n\ndata:\n  a: \"1\"\n  b: \"2\"\n"
+	reordered := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  namespace: n\n  name: c\ndata:\n  b: \"2\"\n  a: \"1\"\n"
+	sa := "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: c\n  namespace: n\n"
+	changed := strings.Replace(cm, `b: "2"`, `b: "3"`, 1)
+	objs := parseObjs(t, cm, sa, reordered, changed)
+	for i, file := range []string{"a.yaml", "sa.yaml", "b.yaml", "c.yaml"} {
+		objs[i].Source = Source{File: file, Line: 1}
+	}
+
+	out, dups, err := Dedupe(objs[:3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 || out[0].Source.File != "a.yaml" || out[1].Kind != "ServiceAccount" {
+		t.Fatalf("out = %+v, want the first ConfigMap and the ServiceAccount", out)
+	}
+	if len(dups) != 1 || !strings.Contains(dups[0].String(), "ConfigMap n/c rendered 2 times by a.yaml (document 0, line 1), b.yaml (document 0, line 1)") {
+		t.Errorf("dups = %v", dups)
+	}
+
+	_, _, err = Dedupe([]Obj{objs[0], objs[3]})
+	if err == nil || !strings.Contains(err.Error(), "at data.b by a.yaml (document 0, line 1) and c.yaml (document 0, line 1)") {
+		t.Errorf("err = %v, want conflict at data.b", err)
+	}
+}
+
+// parseObjs parses each YAML document in docs into an Obj.
+func parseObjs(t *testing.T, docs ...string) []Obj {
+	t.Helper()
+	objs := make([]Obj, 0, len(docs))
+	for _, d := range docs {
+		o, err := Parse(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		objs = append(objs, o)
+	}
+	return objs
+}
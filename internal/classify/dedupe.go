@@ -0,0 +1,139 @@
+package classify
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Duplicate is an object rendered more than once with identical content.
+// Dedupe keeps the first copy; Sources lists where every copy came from.
+type Duplicate struct {
+	Obj     Obj
+	Sources []Source
+}
+
+// Dedupe finds objects with the same apiVersion, kind, namespace and name.
+// Identical copies are merged into the first one and reported as duplicates;
+// the first copy that differs is an error naming its source, the source of the
+// first copy, and the first field where the two disagree.
+func Dedupe(objs []Obj) ([]Obj, []Duplicate, error) {
+	type copies struct {
+		first int
+		all   []Obj
+	}
+	byKey := map[string]*copies{}
+	var keys []string
+	for i, o := range objs {
+		k := o.APIVersion + "/" + o.Kind + "/" + o.Namespace + "/" + o.Name
+		c, ok := byKey[k]
+		if !ok {
+			c = &copies{first: i}
+			byKey[k] = c
+			keys = append(keys, k)
+		}
+		c.all = append(c.all, o)
+	}
+	if len(keys) == len(objs) {
+		return objs, nil, nil
+	}
+
+	var dups []Duplicate
+	for _, k := range keys {
+		c := byKey[k]
+		if len(c.all) == 1 {
+			continue
+		}
+		first, err := decode(c.all[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		sources := []Source{c.all[0].Source}
+		for _, o := range c.all[1:] {
+			other, err := decode(o)
+			if err != nil {
+				return nil, nil, err
+			}
+			sources = append(sources, o.Source)
+			if field := firstDiff(first, other, ""); field != "" {
+				return nil, nil, fmt.Errorf("%s %s rendered differently at %s by %s and %s",
+					o.Kind, qualifiedName(o), field, c.all[0].Source, o.Source)
+			}
+		}
+		dups = append(dups, Duplicate{Obj: c.all[0], Sources: sources})
+	}
+
+	out := make([]Obj, 0, len(keys))
+	for i, o := range objs {
+		if byKey[o.APIVersion+"/"+o.Kind+"/"+o.Namespace+"/"+o.Name].first == i {
+			out = append(out, o)
+		}
+	}
+	return out, dups, nil
+}
+
+func (d Duplicate) String() string {
+	s := make([]string, len(d.Sources))
+	for i, src := range d.Sources {
+		s[i] = src.String()
+	}
+	return fmt.Sprintf("%s %s rendered %d times by %s", d.Obj.Kind, qualifiedName(d.Obj), len(d.Sources), strings.Join(s, ", "))
+}
+
+func qualifiedName(o Obj) string {
+	if o.Namespace == "" {
+		return o.Name
+	}
+	return o.Namespace + "/" + o.Name
+}
+
+func decode(o Obj) (any, error) {
+	var v any
+	if err := o.Node.Decode(&v); err != nil {
+		return nil, fmt.Errorf("%s: %w", o.Source, err)
+	}
+	return v, nil
+}
+
+// firstDiff returns the path of the first field where a and b differ, in
+// sorted key order, or "" if they are equal.
+func firstDiff(a, b any, path string) string {
+	am, aok := a.(map[string]any)
+	bm, bok := b.(map[string]any)
+	if aok && bok {
+		keys := make([]string, 0, len(am)+len(bm))
+		for k := range am {
+			keys = append(keys, k)
+		}
+		for k := range bm {
+			if _, ok := am[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if d := firstDiff(am[k], bm[k], path+"."+k); d != "" {
+				return d
+			}
+		}
+		return ""
+	}
+	as, aok := a.([]any)
+	bs, bok := b.([]any)
+	if aok && bok && len(as) == len(bs) {
+		for i := range as {
+			if d := firstDiff(as[i], bs[i], fmt.Sprintf("%s[%d]", path, i)); d != "" {
+				return d
+			}
+		}
+		return ""
+	}
+	if reflect.DeepEqual(a, b) {
+		return ""
+	}
+	if path == "" {
+		return "."
+	}
+	return strings.TrimPrefix(path, ".")
+}
@@ -0,0 +1,138 @@
+package classify
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// Group names used by Rule.Group.
+const (
+	GroupCRDs      = "crds"
+	GroupCore      = "core"
+	GroupRBAC      = "rbac"
+	GroupWorkloads = "workloads"
+	GroupOthers    = "others"
+)
+
+// Rule assigns matching objects to a group and orders them within it. APIGroup,
+// Kind and Name are globs (path.Match syntax); an empty field matches anything.
+// The core API group is matched as "core".
+type Rule struct {
+	APIGroup string
+	Kind     string
+	Name     string
+	Group    string
+	// Weight orders objects within a group, lowest first. Ties sort by kind,
+	// namespace and name.
+	Weight int
+}
+
+func (r Rule) matches(o Obj) bool {
+	return glob(r.APIGroup, apiGroup(o.APIVersion)) && glob(r.Kind, o.Kind) && glob(r.Name, o.Name)
+}
+
+// Rules is an ordered rule table. The first matching rule wins; objects no
+// rule matches go to Others after everything else.
+type Rules []Rule
+
+// CRDRule sends CustomResourceDefinitions, and only them, to GroupCRDs.
+var CRDRule = Rule{APIGroup: "apiextensions.k8s.io", Kind: "CustomResourceDefinition", Group: GroupCRDs}
+
+// DefaultRules covers the kinds ACK charts and common add-ons render.
+var DefaultRules = Rules{
+	CRDRule,
+
+	{APIGroup: "core", Kind: "Namespace", Group: GroupCore, Weight: 0},
+	{APIGroup: "core", Kind: "ServiceAccount", Group: GroupCore, Weight: 10},
+	{APIGroup: "core", Kind: "Secret", Group: GroupCore, Weight: 20},
+	{APIGroup: "core", Kind: "ConfigMap", Group: GroupCore, Weight: 30},
+	{APIGroup: "core", Kind: "Service", Group: GroupCore, Weight: 40},
+	{APIGroup: "coordination.k8s.io", Kind: "Lease", Group: GroupCore, Weight: 50},
+
+	{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Group: GroupRBAC, Weight: 0},
+	{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Group: GroupRBAC, Weight: 10},
+	{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding", Group: GroupRBAC, Weight: 20},
+	{APIGroup: "rbac.authorization.k8s.io", Kind: "RoleBinding", Group: GroupRBAC, Weight: 30},
+
+	{APIGroup: "apps", Kind: "Deployment", Group: GroupWorkloads, Weight: 0},
+	{APIGroup: "apps", Kind: "StatefulSet", Group: GroupWorkloads, Weight: 10},
+	{APIGroup: "apps", Kind: "DaemonSet", Group: GroupWorkloads, Weight: 20},
+	{APIGroup: "batch", Kind: "Job", Group: GroupWorkloads, Weight: 30},
+	{APIGroup: "batch", Kind: "CronJob", Group: GroupWorkloads, Weight: 40},
+
+	{APIGroup: "policy", Kind: "PodDisruptionBudget", Group: GroupOthers, Weight: 0},
+	{APIGroup: "autoscaling", Kind: "HorizontalPodAutoscaler", Group: GroupOthers, Weight: 10},
+	{APIGroup: "networking.k8s.io", Kind: "NetworkPolicy", Group: GroupOthers, Weight: 20},
+	{APIGroup: "networking.k8s.io", Kind: "Ingress", Group: GroupOthers, Weight: 30},
+	{APIGroup: "monitoring.coreos.com", Kind: "ServiceMonitor", Group: GroupOthers, Weight: 40},
+	{APIGroup: "monitoring.coreos.com", Kind: "PodMonitor", Group: GroupOthers, Weight: 50},
+	{APIGroup: "admissionregistration.k8s.io", Kind: "*WebhookConfiguration", Group: GroupOthers, Weight: 60},
+}
+
+// unmatchedWeight places objects no rule matches after every ruled object in Others.
+const unmatchedWeight = 1 << 30
+
+// Classify groups objs with DefaultRules.
+func Classify(objs []Obj) Groups { return DefaultRules.Classify(objs) }
+
+// Classify assigns each object to the group of the first rule it matches and
+// sorts every group by weight, kind, namespace and name.
+func (rs Rules) Classify(objs []Obj) Groups {
+	type ranked struct {
+		obj    Obj
+		weight int
+	}
+	buckets := map[string][]ranked{}
+	for _, o := range objs {
+		group, weight := GroupOthers, unmatchedWeight
+		for _, r := range rs {
+			if r.matches(o) {
+				group, weight = r.Group, r.Weight
+				break
+			}
+		}
+		buckets[group] = append(buckets[group], ranked{o, weight})
+	}
+
+	sorted := func(group string) []Obj {
+		list := buckets[group]
+		sort.SliceStable(list, func(i, j int) bool {
+			a, b := list[i], list[j]
+			if a.weight != b.weight {
+				return a.weight < b.weight
+			}
+			ka := a.obj.Kind + "/" + a.obj.Namespace + "/" + a.obj.Name
+			kb := b.obj.Kind + "/" + b.obj.Namespace + "/" + b.obj.Name
+			return ka < kb
+		})
+		out := make([]Obj, len(list))
+		for i, r := range list {
+			out[i] = r.obj
+		}
+		return out
+	}
+	return Groups{
+		CRDs:      sorted(GroupCRDs),
+		Core:      sorted(GroupCore),
+		RBAC:      sorted(GroupRBAC),
+		Workloads: sorted(GroupWorkloads),
+		Others:    sorted(GroupOthers),
+	}
+}
+
+// apiGroup returns the API group of an apiVersion, or "core" for the core group.
+func apiGroup(apiVersion string) string {
+	if g, _, ok := strings.Cut(apiVersion, "/"); ok {
+		return g
+	}
+	return "core"
+}
+
+func glob(pattern, s string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
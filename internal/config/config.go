@@ -3,83 +3,332 @@ package config
 import (
 	"errors"
 	"fmt"
-	"os"
+	"strings"
 
-	"gopkg.in/yaml.v3"
+	"github.com/jayadeyemi/ack-kro-gen/internal/util"
 )
 
+// Struct tags drive both decoding and the published JSON Schema (see Schema):
+// `desc` is the field description and `jsonschema` holds constraints such as
+// required, enum=a|b, type=boolean|string, minItems=n, or partial (required
+// constraints below the field are not enforced).
+
 type Root struct {
-	Graphs []GraphSpec `yaml:"graphs"`
+	// Defaults is inherited by every graph entry and deep-merged beneath it.
+	Defaults GraphSpec   `yaml:"defaults,omitempty" jsonschema:"partial" desc:"Settings inherited by every graph entry; each graph is deep-merged over them."`
+	Graphs   []GraphSpec `yaml:"graphs,omitempty" desc:"One entry per ACK service controller to generate RGDs for. Entries in later files or overlays merge by service."`
+	// ValuesFiles apply to every graph, before the graph's own valuesFiles.
+	ValuesFiles []string `yaml:"valuesFiles,omitempty" desc:"Helm values files applied to every graph before its own valuesFiles. Relative paths resolve against the graphs file."`
+	// Overlays holds environment-specific layers keyed by environment name.
+	// LoadFiles applies the selected one and does not populate this field.
+	Overlays map[string]Overlay `yaml:"overlays,omitempty" desc:"Environment-specific layers keyed by name and selected with --env."`
+}
+
+// Overlay is an environment-specific layer selected with --env. It is merged
+// over the base files the same way an additional graphs file would be.
+type Overlay struct {
+	Defaults GraphSpec   `yaml:"defaults,omitempty" jsonschema:"partial" desc:"Defaults merged over the base defaults."`
+	Graphs   []GraphSpec `yaml:"graphs,omitempty" desc:"Graph entries merged over base entries with the same service; new services are appended."`
 }
 
 type GraphSpec struct {
-	Service        string         `yaml:"service"`
-	Version        string         `yaml:"version"`
-	ReleaseName    string         `yaml:"releaseName"`
-	Namespace      string         `yaml:"namespace"`
-	AWS            AWSSpec        `yaml:"aws"`
-	Image          ImageSpec      `yaml:"image"`
-	ServiceAccount SASpec         `yaml:"serviceAccount"`
-	Controller     ControllerSpec `yaml:"controller"`
-	Extras         ExtrasSpec     `yaml:"extras"`
+	Service        string            `yaml:"service,omitempty" jsonschema:"required" desc:"ACK service name, e.g. s3 or ec2. Selects the <service>-chart from the ACK public ECR registry."`
+	Version        string            `yaml:"version,omitempty" desc:"ACK chart version to render. Required for every graph once defaults are merged."`
+	ReleaseName    string            `yaml:"releaseName,omitempty" desc:"Controller release name. Defaults to ack-<service>-controller."`
+	Namespace      string            `yaml:"namespace,omitempty" desc:"Namespace the controller is installed into. Defaults to ack-system."`
+	AWS            AWSSpec           `yaml:"aws,omitempty" desc:"AWS account, region and credentials settings."`
+	IAMRole        IAMRoleSpec       `yaml:"iamRole,omitempty" desc:"IRSA IAM role generated into the controller graph."`
+	CARM           CARMSpec          `yaml:"carm,omitempty" desc:"Cross-account resource management: the accounts and roles the controller may manage resources in."`
+	RBAC           RBACSpec          `yaml:"rbac,omitempty" desc:"How the rendered RBAC is emitted."`
+	Image          ImageSpec         `yaml:"image,omitempty" desc:"Controller image overrides."`
+	ServiceAccount SASpec            `yaml:"serviceAccount,omitempty" desc:"Controller service account settings."`
+	Controller     ControllerSpec    `yaml:"controller,omitempty" desc:"Controller runtime flags."`
+	Extras         ExtrasSpec        `yaml:"extras,omitempty" desc:"Additional chart inputs."`
+	ValuesFiles    []string          `yaml:"valuesFiles,omitempty" desc:"Helm values files applied in order, like helm -f, before extras.values. A graph's list is appended to the one in defaults. Relative paths resolve against the graphs file."`
+	Hooks          HooksSpec         `yaml:"hooks,omitempty" desc:"How Helm hooks and test templates are handled."`
+	CRDs           CRDsSpec          `yaml:"crds,omitempty" desc:"How CRDs are slimmed in the <service>-crds RGD."`
+	RGD            RGDSpec           `yaml:"rgd,omitempty" desc:"Checks on the controller and hooks RGDs."`
+	Kustomize      string            `yaml:"kustomize,omitempty" desc:"Kustomization directory applied to the rendered manifests before KRO conversion. The rendered objects are added to its resources. Relative paths resolve against the graphs file."`
+	Transformers   []TransformerSpec `yaml:"transformers,omitempty" desc:"Patches and plugins applied in order to the rendered controller objects before they are converted to KRO resources."`
+	Classification []ClassifyRule    `yaml:"classification,omitempty" desc:"Rules that group and order rendered objects. They are tried in order before the built-in rules; the first match wins."`
+	KubeVersion    string            `yaml:"kubeVersion,omitempty" desc:"Kubernetes version exposed to templates as .Capabilities.KubeVersion, e.g. v1.29.0. Defaults to v1.27.0."`
+	APIVersions    []string          `yaml:"apiVersions,omitempty" desc:"Extra API versions exposed to templates via .Capabilities.APIVersions, e.g. monitoring.coreos.com/v1 or policy/v1/PodDisruptionBudget."`
+	Set            []string          `yaml:"set,omitempty" desc:"Helm --set style overrides (key=value), applied after every other values source."`
 }
 
 type ImageSpec struct {
-	Repository string `yaml:"repository"`
-	Tag        string `yaml:"tag"`
+	Repository string `yaml:"repository,omitempty" desc:"Image repository. Defaults to public.ecr.aws/aws-controllers-k8s/<service>-controller."`
+	Tag        string `yaml:"tag,omitempty" desc:"Image tag. Defaults to the chart appVersion."`
 }
 
 type SASpec struct {
-	Name        string            `yaml:"name"`
-	Annotations map[string]string `yaml:"annotations"`
+	Name        string            `yaml:"name,omitempty" desc:"Service account name. Defaults to ack-<service>-controller."`
+	Annotations map[string]string `yaml:"annotations,omitempty" desc:"Annotations added to the service account, e.g. eks.amazonaws.com/role-arn."`
 }
 
 type AWSSpec struct {
-	Region      string `yaml:"region"`
-	AccountID   string `yaml:"accountID"`
-	Credentials string `yaml:"credentials"`
-	SecretName  string `yaml:"secretName"`
-	Profile     string `yaml:"profile"`
+	Auth        AuthSpec `yaml:"auth,omitempty" desc:"How the controller obtains AWS credentials."`
+	Region      string   `yaml:"region,omitempty" desc:"AWS region the controller manages resources in."`
+	AccountID   string   `yaml:"accountID,omitempty" desc:"AWS account ID the controller runs against."`
+	Credentials string   `yaml:"credentials,omitempty" desc:"Key inside the credentials secret that holds the shared credentials file."`
+	SecretName  string   `yaml:"secretName,omitempty" desc:"Name of a secret holding static AWS credentials. With auth mode secret, the graph mounts this existing Secret instead of creating one."`
+	Profile     string   `yaml:"profile,omitempty" desc:"Profile to use from the shared credentials file."`
+}
+
+// Auth modes for AuthSpec.Mode.
+const (
+	// AuthModeIRSA annotates the service account with an IAM role ARN.
+	AuthModeIRSA = "irsa"
+	// AuthModePodIdentity associates the service account with an IAM role
+	// through EKS Pod Identity.
+	AuthModePodIdentity = "podIdentity"
+	// AuthModeSecret reads static credentials from a Secret.
+	AuthModeSecret = "secret"
+)
+
+type AuthSpec struct {
+	Mode        string `yaml:"mode,omitempty" jsonschema:"enum=irsa|podIdentity|secret" desc:"irsa points the service account's eks.amazonaws.com/role-arn annotation at the IAM role; podIdentity adds an IAM role and an EKS PodIdentityAssociation for the service account and drops that annotation; secret uses static credentials from a Secret. Defaults to irsa."`
+	ClusterName string `yaml:"clusterName,omitempty" desc:"podIdentity only: EKS cluster the PodIdentityAssociation is created in. Default for the schema's podIdentity.clusterName, which is required on every instance when this is unset."`
+}
+
+// IAMRoleSpec configures the ACK IAM Role generated for the controller. The
+// role is created by the ACK IAM controller, which must be installed.
+type IAMRoleSpec struct {
+	Create       bool     `yaml:"create,omitempty" desc:"irsa mode: add an iam.services.k8s.aws Role trusted by the controller's service account, and point the service account's eks.amazonaws.com/role-arn annotation at it. podIdentity mode always adds the role."`
+	OIDCProvider string   `yaml:"oidcProvider,omitempty" desc:"Cluster OIDC provider without the https:// prefix, e.g. oidc.eks.us-west-2.amazonaws.com/id/EXAMPLE. Default for the schema's iamRole.oidcProvider."`
+	PolicyARNs   []string `yaml:"policyARNs,omitempty" desc:"Managed policies attached to the role. Defaults to the controller's recommended policy."`
+}
+
+// CARMSpec configures cross-account resource management (CARM): the role the
+// controller assumes in each account it manages resources in.
+type CARMSpec struct {
+	Accounts map[string]string `yaml:"accounts,omitempty" desc:"Role ARN the controller assumes per 12-digit AWS account ID. Written to the ack-role-account-map ConfigMap and the default for the schema's carm.accounts. The graph does not annotate namespaces, so each namespace still needs the services.k8s.aws/owner-account-id annotation."`
+}
+
+type RBACSpec struct {
+	NamespaceScope bool `yaml:"namespaceScope,omitempty" desc:"Also emit a namespace-scoped variant of the cluster RBAC: Roles in the watch namespace for namespaced resources, keeping only cluster-level rules such as namespaces and CRD reads in ClusterRoles. The schema's installScope (cluster or namespace) selects the variant KRO creates."`
+}
+
+type CRDsSpec struct {
+	StripDescriptions  bool `yaml:"stripDescriptions,omitempty" desc:"Remove description fields from the CRD schemas and printer columns."`
+	ServedVersionsOnly bool `yaml:"servedVersionsOnly,omitempty" desc:"Drop CRD versions that are not served. The storage version is always kept. The API server rejects a CRD update that drops a version still listed in status.storedVersions, so migrate stored objects and trim storedVersions first."`
+	MaxBytes           int  `yaml:"maxBytes,omitempty" desc:"Size cap in bytes for the CRDs. While it is exceeded, descriptions and then non-served versions are dropped; generation fails if the CRDs still do not fit. 0 disables the cap."`
+	WarnBytes          int  `yaml:"warnBytes,omitempty" desc:"Log a warning naming the largest CRDs when the CRDs RGD is written larger than this many bytes. Defaults to 1048576."`
+}
+
+type RGDSpec struct {
+	WarnBytes int `yaml:"warnBytes,omitempty" desc:"Log a warning naming the largest resources when the controller or hooks RGD is written larger than this many bytes. The CRDs RGD has its own crds.warnBytes. Defaults to 262144."`
 }
+
 type ControllerSpec struct {
-	LogLevel       string `yaml:"logLevel"`
-	LogDev         string `yaml:"logDev"`
-	WatchNamespace string `yaml:"watchNamespace"`
+	LogLevel       string `yaml:"logLevel,omitempty" jsonschema:"enum=debug|info|warn|error" desc:"Controller log level."`
+	LogDev         string `yaml:"logDev,omitempty" jsonschema:"type=boolean|string" desc:"Enable development logging (true or false)."`
+	WatchNamespace string `yaml:"watchNamespace,omitempty" desc:"Restrict the controller to a single namespace. Empty watches all namespaces."`
+}
+
+// Hook policies for HooksSpec.Policy.
+const (
+	// HookPolicyDrop removes hooks and tests from the output.
+	HookPolicyDrop = "drop"
+	// HookPolicySeparate moves hooks and tests into their own <service>-hooks RGD.
+	HookPolicySeparate = "separate"
+	// HookPolicyConvert keeps install/upgrade hooks as ordinary resources, pre-* hooks
+	// first and post-* hooks last, and drops tests and delete/rollback hooks.
+	HookPolicyConvert = "convert"
+)
+
+type HooksSpec struct {
+	Policy string `yaml:"policy,omitempty" jsonschema:"enum=drop|separate|convert" desc:"drop removes hooks and tests; separate emits them into a <service>-hooks RGD; convert orders pre-install/pre-upgrade hooks before other resources and post-install/post-upgrade hooks after them, dropping tests and delete/rollback hooks. Defaults to drop."`
+}
+
+// Transformer types for TransformerSpec.Type.
+const (
+	TransformerJSON6902       = "json6902"
+	TransformerStrategicMerge = "strategicMerge"
+	TransformerExec           = "exec"
+)
+
+// TransformerSpec configures one post-render transformer. Patches come from
+// Patch or from the file at Path; exec plugins run Command.
+type TransformerSpec struct {
+	Type    string     `yaml:"type" jsonschema:"required,enum=json6902|strategicMerge|exec" desc:"json6902 applies an RFC 6902 JSON patch to each target; strategicMerge applies a strategic merge patch (JSON merge patch for kinds without a strategy); exec pipes all objects as multi-document YAML through command and reads them back from stdout."`
+	Target  TargetSpec `yaml:"target,omitempty" desc:"Objects to patch. Required for json6902; strategicMerge defaults to the kind and name in the patch."`
+	Patch   string     `yaml:"patch,omitempty" desc:"Inline patch, as YAML or JSON."`
+	Path    string     `yaml:"path,omitempty" desc:"Patch file, relative to the graphs file that names it."`
+	Command []string   `yaml:"command,omitempty" desc:"exec only: program and arguments. A program starting with ./ or ../ is relative to the graphs file."`
+}
+
+// TargetSpec selects rendered objects. Empty fields match anything.
+type TargetSpec struct {
+	APIVersion string `yaml:"apiVersion,omitempty" desc:"apiVersion to match, e.g. apps/v1."`
+	Kind       string `yaml:"kind,omitempty" desc:"Kind to match, e.g. Deployment."`
+	Name       string `yaml:"name,omitempty" desc:"Name to match, as a glob pattern (e.g. *-controller)."`
+}
+
+// ClassifyRule places matching objects in a resource group. Empty match fields
+// match anything.
+type ClassifyRule struct {
+	APIGroup string `yaml:"apiGroup,omitempty" desc:"API group to match, as a glob. Use core for the core group, e.g. Secret and ConfigMap."`
+	Kind     string `yaml:"kind,omitempty" desc:"Kind to match, as a glob."`
+	Name     string `yaml:"name,omitempty" desc:"Object name to match, as a glob."`
+	Group    string `yaml:"group" jsonschema:"required,enum=core|rbac|workloads|others" desc:"Group the objects are emitted in. Groups are emitted in the order core, rbac, workloads, others, after the CRDs, which always go to the <service>-crds RGD."`
+	Weight   int    `yaml:"weight,omitempty" desc:"Order within the group, lowest first. Ties sort by kind, namespace and name."`
 }
 
 type ExtrasSpec struct {
-	Values map[string]any `yaml:"values"`
+	Values map[string]any `yaml:"values,omitempty" desc:"Raw Helm values merged over valuesFiles. Key <service>-chart is applied first, then ack-chart, then the other keys."`
+}
+
+// DefaultNamespace is the namespace used when a graph sets none.
+const DefaultNamespace = "ack-system"
+
+// DefaultCRDWarnBytes is the CRDs RGD size above which a warning is logged,
+// leaving headroom below the 1.5 MiB etcd request limit.
+const DefaultCRDWarnBytes = 1 << 20
+
+// DefaultRGDWarnBytes is the controller and hooks RGD size above which a
+// warning is logged. Those graphs hold no schemas, so a much smaller size
+// already points at an unexpectedly large rendered object.
+const DefaultRGDWarnBytes = 1 << 18
+
+// DefaultReleaseName returns the release name used when a graph sets none.
+func DefaultReleaseName(service string) string {
+	return fmt.Sprintf("ack-%s-controller", service)
+}
+
+// ApplyChartDefaults fills fields whose defaults come from the chart itself.
+// It is called once the chart is loaded; the image tag defaults to appVersion.
+func (g *GraphSpec) ApplyChartDefaults(appVersion string) {
+	if g.Image.Tag == "" {
+		g.Image.Tag = appVersion
+	}
 }
 
+// Load reads a single graphs.yaml with no environment overlay.
 func Load(path string) (*Root, error) {
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+	return LoadFiles([]string{path}, "")
+}
+
+// LoadFiles reads one or more graphs.yaml files, validates each against Schema
+// and merges them in order: defaults deep-merge, and graphs entries are
+// matched by service. When env is set, overlays[env] is merged last.
+// ${ENV:...} and ${FILE:...} references are expanded in the merged result, so
+// overlays that are not selected are never resolved. The defaults block is
+// then merged beneath every graph, top-level valuesFiles (accumulated across
+// files) and defaults.valuesFiles are prepended to each graph's own, and
+// documented defaults are applied. Unknown fields are rejected and every error
+// carries the file, line and column it refers to. Only service and version are
+// required per graph.
+func LoadFiles(paths []string, env string) (*Root, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("graphs: no config files given")
+	}
+	merged := &layer{}
+	in := newInterpolator()
+	for _, p := range paths {
+		l, err := readLayer(p, in)
+		if err != nil {
+			return nil, err
+		}
+		merged.apply(l)
+	}
+	if env != "" {
+		ovs, ok := merged.overlays[env]
+		if !ok {
+			return nil, fmt.Errorf("graphs: overlay %q not found (available: %s)", env, strings.Join(merged.envs(), ", "))
+		}
+		for _, ov := range ovs {
+			l, err := layerFrom(ov.file, ov.node, fmt.Sprintf("overlays.%s.", env))
+			if err != nil {
+				return nil, err
+			}
+			merged.apply(l)
+		}
+	}
+	if len(merged.graphs) == 0 {
+		return nil, &Error{File: strings.Join(paths, ","), Field: "graphs", Msg: "at least one service is required"}
+	}
+
+	// Expand references in what is left after merging, and check the
+	// expanded values against the schema.
+	schema := Schema()["properties"].(map[string]any)
+	if merged.defaults != nil {
+		if err := in.expand(merged.defaults, "defaults"); err != nil {
+			return nil, err
+		}
+		if err := validateNode(paths[0], merged.defaults, schema["defaults"].(map[string]any), "defaults"); err != nil {
+			return nil, err
+		}
 	}
-	var r Root
-	if err := yaml.Unmarshal(b, &r); err != nil {
-		return nil, err
+	graphSchema := schema["graphs"].(map[string]any)["items"].(map[string]any)
+	for _, g := range merged.graphs {
+		if err := in.expand(g.node, g.field); err != nil {
+			return nil, err
+		}
+		if err := validateNode(g.file, g.node, graphSchema, g.field); err != nil {
+			return nil, err
+		}
 	}
-	if len(r.Graphs) == 0 {
-		return nil, errors.New("graphs: at least one service is required")
+
+	r := Root{ValuesFiles: merged.valuesFiles}
+	if merged.defaults != nil {
+		if err := merged.defaults.Decode(&r.Defaults); err != nil {
+			return nil, nodeError(paths[0], merged.defaults, "defaults", "%v", err)
+		}
 	}
-	for i := range r.Graphs {
-		g := &r.Graphs[i]
-		if g.Service == "" {
-			return nil, fmt.Errorf("graphs[%d]: service is required", i)
+	for _, g := range merged.graphs {
+		node := mergeNodes(merged.defaults, g.node)
+		var gs GraphSpec
+		if err := node.Decode(&gs); err != nil {
+			return nil, nodeError(g.file, g.node, g.field, "%v", err)
+		}
+		// version may come from defaults or another file, so it is checked
+		// after merging rather than marked required in the schema.
+		if gs.Version == "" {
+			return nil, nodeError(g.file, g.node, g.field, "version is required")
+		}
+		if err := checkTransformers(g.file, node, g.field, gs.Transformers); err != nil {
+			return nil, err
 		}
-		if g.Version == "" {
-			return nil, fmt.Errorf("graphs[%d]: version is required", i)
+		if err := checkClassification(g.file, node, g.field, gs.Classification); err != nil {
+			return nil, err
 		}
-		if g.Image.Tag == "" {
-			return nil, fmt.Errorf("graphs[%d]: image tag is required", i)
+		if err := checkAuth(g.file, node, g.field, gs); err != nil {
+			return nil, err
 		}
-		if g.ReleaseName == "" {
-			return nil, fmt.Errorf("graphs[%d]: releaseName is required", i)
+		if err := checkCARM(g.file, node, g.field, gs.CARM); err != nil {
+			return nil, err
 		}
-		if g.Namespace == "" {
-			return nil, fmt.Errorf("graphs[%d]: namespace is required", i)
+		// valuesFiles accumulate rather than replace: top-level, then
+		// defaults, then the graph's own.
+		files := append([]string{}, merged.valuesFiles...)
+		if util.MappingValue(g.node, "valuesFiles") != nil {
+			files = append(files, r.Defaults.ValuesFiles...)
 		}
+		gs.ValuesFiles = append(files, gs.ValuesFiles...)
+		gs.applyDefaults()
+		r.Graphs = append(r.Graphs, gs)
 	}
 	return &r, nil
 }
+
+func (g *GraphSpec) applyDefaults() {
+	if g.ReleaseName == "" {
+		g.ReleaseName = DefaultReleaseName(g.Service)
+	}
+	if g.Namespace == "" {
+		g.Namespace = DefaultNamespace
+	}
+	if g.Hooks.Policy == "" {
+		g.Hooks.Policy = HookPolicyDrop
+	}
+	if g.AWS.Auth.Mode == "" {
+		g.AWS.Auth.Mode = AuthModeIRSA
+	}
+	if g.CRDs.WarnBytes == 0 {
+		g.CRDs.WarnBytes = DefaultCRDWarnBytes
+	}
+	if g.RGD.WarnBytes == 0 {
+		g.RGD.WarnBytes = DefaultRGDWarnBytes
+	}
+}
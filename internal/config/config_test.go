@@ -0,0 +1,398 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeGraphs(t *testing.T, body string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "graphs.yaml")
+	if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoadDefaultsInheritance(t *testing.T) {
+	p := writeGraphs(t, `
+defaults:
+  releaseName: ack-controller
+  namespace: ack-system
+  image:
+    repository: mirror.example.com/ack
+    tag: latest
+  controller:
+    logLevel: debug
+  extras:
+    values:
+      deployment:
+        replicas: 2
+        labels:
+          team: platform
+graphs:
+  - service: s3
+    version: "1.1.1"
+    image:
+      tag: "1.1.1"
+    extras:
+      values:
+        deployment:
+          labels:
+            tier: storage
+  - service: ec2
+    version: "1.7.0"
+    namespace: ec2-system
+`)
+	cfg, err := Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Graphs) != 2 {
+		t.Fatalf("got %d graphs", len(cfg.Graphs))
+	}
+	s3, ec2 := cfg.Graphs[0], cfg.Graphs[1]
+	if s3.Image.Repository != "mirror.example.com/ack" || s3.Image.Tag != "1.1.1" {
+		t.Fatalf("s3 image not merged: %+v", s3.Image)
+	}
+	if s3.Namespace != "ack-system" || ec2.Namespace != "ec2-system" {
+		t.Fatalf("namespace inheritance: s3=%q ec2=%q", s3.Namespace, ec2.Namespace)
+	}
+	if ec2.Controller.LogLevel != "debug" {
+		t.Fatalf("ec2 logLevel = %q", ec2.Controller.LogLevel)
+	}
+	dep := s3.Extras.Values["deployment"].(map[string]any)
+	labels := dep["labels"].(map[string]any)
+	if dep["replicas"] != 2 || labels["team"] != "platform" || labels["tier"] != "storage" {
+		t.Fatalf("extras.values not deep-merged: %v", dep)
+	}
+	if _, ok := ec2.Extras.Values["deployment"].(map[string]any)["labels"].(map[string]any)["tier"]; ok {
+		t.Fatal("s3 overrides leaked into ec2")
+	}
+}
+
+func TestLoadAppliesDocumentedDefaults(t *testing.T) {
+	p := writeGraphs(t, `
+graphs:
+  - service: s3
+    version: "1.1.1"
+`)
+	cfg, err := Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := cfg.Graphs[0]
+	if g.ReleaseName != "ack-s3-controller" || g.Namespace != "ack-system" {
+		t.Fatalf("defaults not applied: releaseName=%q namespace=%q", g.ReleaseName, g.Namespace)
+	}
+	if g.Image.Tag != "" {
+		t.Fatalf("image tag should wait for chart appVersion, got %q", g.Image.Tag)
+	}
+	g.ApplyChartDefaults("1.1.1")
+	if g.Image.Tag != "1.1.1" {
+		t.Fatalf("image tag = %q", g.Image.Tag)
+	}
+}
+
+func TestLoadRejectsUnknownFields(t *testing.T) {
+	p := writeGraphs(t, `graphs:
+  - service: s3
+    version: "1.1.1"
+    image:
+      tga: "1.1.1"
+`)
+	_, err := Load(p)
+	cerr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected *Error, got %T: %v", err, err)
+	}
+	if cerr.Line != 5 || cerr.Column != 7 || cerr.Field != "graphs[0].image" {
+		t.Fatalf("unexpected position: %v", cerr)
+	}
+}
+
+func TestLoadRequiresVersion(t *testing.T) {
+	p := writeGraphs(t, `graphs:
+  - service: s3
+  - service: ec2
+`)
+	_, err := Load(p)
+	cerr, ok := err.(*Error)
+	if !ok || cerr.Field != "graphs[0]" || cerr.Line != 2 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadChecksTransformers(t *testing.T) {
+	p := writeGraphs(t, `graphs:
+  - service: s3
+    version: "1.1.1"
+    transformers:
+      - type: strategicMerge
+        path: patches/sidecar.yaml
+      - type: json6902
+        patch: "[]"
+`)
+	_, err := Load(p)
+	cerr, ok := err.(*Error)
+	if !ok || cerr.Field != "graphs[0].transformers[1]" || cerr.Line != 7 || cerr.Msg != "json6902 needs a target" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadChecksCARM(t *testing.T) {
+	p := writeGraphs(t, `graphs:
+  - service: s3
+    version: "1.1.1"
+    carm:
+      accounts:
+        "111122223333": arn:aws:iam::111122223333:role/ack
+        "44445556666": arn:aws:iam::44445556666:role/ack
+`)
+	_, err := Load(p)
+	cerr, ok := err.(*Error)
+	if !ok || cerr.Field != `graphs[0].carm.accounts.44445556666` || cerr.Line != 7 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadFilesMergesByServiceAndEnv(t *testing.T) {
+	base := writeGraphs(t, `
+defaults:
+  namespace: ack-system
+graphs:
+  - service: s3
+    version: "1.1.1"
+  - service: ec2
+    version: "1.7.0"
+overlays:
+  prod:
+    defaults:
+      image:
+        repository: prod.example.com/ack
+    graphs:
+      - service: s3
+        namespace: s3-prod
+`)
+	extra := writeGraphs(t, `
+graphs:
+  - service: ec2
+    controller:
+      logLevel: debug
+  - service: rds
+    version: "1.6.2"
+`)
+
+	cfg, err := LoadFiles([]string{base, extra}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Graphs) != 3 || cfg.Graphs[1].Service != "ec2" || cfg.Graphs[2].Service != "rds" {
+		t.Fatalf("unexpected graphs: %+v", cfg.Graphs)
+	}
+	if cfg.Graphs[1].Version != "1.7.0" || cfg.Graphs[1].Controller.LogLevel != "debug" {
+		t.Fatalf("ec2 not merged by service: %+v", cfg.Graphs[1])
+	}
+	if cfg.Graphs[0].Image.Repository != "" {
+		t.Fatal("overlay applied without --env")
+	}
+
+	cfg, err = LoadFiles([]string{base, extra}, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s3, ec2 := cfg.Graphs[0], cfg.Graphs[1]
+	if s3.Namespace != "s3-prod" || s3.Version != "1.1.1" || ec2.Namespace != "ack-system" {
+		t.Fatalf("prod overlay: s3=%+v ec2=%+v", s3, ec2)
+	}
+	if s3.Image.Repository != "prod.example.com/ack" || ec2.Image.Repository != "prod.example.com/ack" {
+		t.Fatal("prod overlay defaults not inherited")
+	}
+
+	if _, err := LoadFiles([]string{base}, "staging"); err == nil {
+		t.Fatal("expected error for unknown overlay")
+	}
+}
+
+func TestLoadAccumulatesValuesFiles(t *testing.T) {
+	path := writeGraphs(t, `
+valuesFiles: [common.yaml]
+defaults:
+  valuesFiles: [defaults.yaml]
+graphs:
+  - service: s3
+    version: "1.1.1"
+    valuesFiles: [s3.yaml]
+  - service: ec2
+    version: "1.7.0"
+`)
+	cfg, err := LoadFiles([]string{path}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"common.yaml defaults.yaml s3.yaml", "common.yaml defaults.yaml"} {
+		var got []string
+		for _, f := range cfg.Graphs[i].ValuesFiles {
+			got = append(got, filepath.Base(f))
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("%s valuesFiles = %v, want %s", cfg.Graphs[i].Service, got, want)
+		}
+	}
+}
+
+func TestLoadInterpolation(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "irsa-arn"), []byte("arn:aws:iam::111122223333:role/ack\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, "graphs.yaml")
+	body := `graphs:
+  - service: s3
+    version: "1.1.1"
+    aws:
+      accountID: ${ENV:TEST_ACCOUNT_ID}
+      region: ${ENV:TEST_REGION:-us-west-2}
+    image:
+      repository: ${ENV:TEST_REGISTRY}/s3-controller
+    serviceAccount:
+      annotations:
+        eks.amazonaws.com/role-arn: ${FILE:irsa-arn}
+    controller:
+      logDev: ${ENV:TEST_LOG_DEV}
+    extras:
+      values:
+        note: "$${ENV:LITERAL} ${schema.spec.name}"
+`
+	if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_ACCOUNT_ID", "111122223333")
+	t.Setenv("TEST_REGISTRY", "registry.example.com")
+	t.Setenv("TEST_LOG_DEV", "true")
+
+	cfg, err := Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := cfg.Graphs[0]
+	if g.AWS.AccountID != "111122223333" || g.AWS.Region != "us-west-2" {
+		t.Fatalf("aws = %+v", g.AWS)
+	}
+	if g.Image.Repository != "registry.example.com/s3-controller" || g.Controller.LogDev != "true" {
+		t.Fatalf("image=%q logDev=%q", g.Image.Repository, g.Controller.LogDev)
+	}
+	if g.ServiceAccount.Annotations["eks.amazonaws.com/role-arn"] != "arn:aws:iam::111122223333:role/ack" {
+		t.Fatalf("file interpolation: %v", g.ServiceAccount.Annotations)
+	}
+	if g.Extras.Values["note"] != "${ENV:LITERAL} ${schema.spec.name}" {
+		t.Fatalf("escape/passthrough: %q", g.Extras.Values["note"])
+	}
+
+	os.Unsetenv("TEST_REGISTRY")
+	_, err = Load(p)
+	cerr, ok := err.(*Error)
+	if !ok || cerr.Line != 8 || cerr.Field != "graphs[0].image.repository" {
+		t.Fatalf("expected positioned missing-variable error, got %v", err)
+	}
+}
+
+func TestLoadInterpolatesSelectedOverlayOnly(t *testing.T) {
+	p := writeGraphs(t, `graphs:
+  - service: s3
+    version: "1.1.1"
+    controller:
+      logLevel: ${ENV:TEST_LOG_LEVEL}
+    extras:
+      values:
+        replicas: ${ENV:TEST_REPLICAS}
+        quoted: "${ENV:TEST_REPLICAS}"
+        empty: ${ENV:TEST_EMPTY}
+overlays:
+  prod:
+    graphs:
+      - service: s3
+        namespace: ${ENV:TEST_PROD_NAMESPACE}
+`)
+	t.Setenv("TEST_LOG_LEVEL", "debug")
+	t.Setenv("TEST_REPLICAS", "2")
+	t.Setenv("TEST_EMPTY", "")
+
+	cfg, err := LoadFiles([]string{p}, "")
+	if err != nil {
+		t.Fatalf("unselected overlay was interpolated: %v", err)
+	}
+	vals := cfg.Graphs[0].Extras.Values
+	if vals["replicas"] != 2 || vals["quoted"] != "2" || vals["empty"] != nil {
+		t.Fatalf("extras.values = %#v", vals)
+	}
+	if cfg.Graphs[0].Controller.LogLevel != "debug" {
+		t.Fatalf("logLevel = %q", cfg.Graphs[0].Controller.LogLevel)
+	}
+
+	_, err = LoadFiles([]string{p}, "prod")
+	cerr, ok := err.(*Error)
+	if !ok || cerr.Field != "graphs[0].namespace" || cerr.Line != 15 {
+		t.Fatalf("expected positioned error from the prod overlay, got %v", err)
+	}
+
+	t.Setenv("TEST_LOG_LEVEL", "verbose")
+	if _, err := LoadFiles([]string{p}, ""); err == nil || !strings.Contains(err.Error(), `"verbose" is not one of`) {
+		t.Fatalf("expanded value not validated: %v", err)
+	}
+}
+
+func TestLoadResolvesInterpolatedPaths(t *testing.T) {
+	p := writeGraphs(t, `valuesFiles: ["${ENV:TEST_TOP_VALUES}"]
+graphs:
+  - service: s3
+    version: "1.1.1"
+    valuesFiles: ["${ENV:TEST_VALUES}", "${ENV:TEST_REL_VALUES}"]
+    kustomize: ${ENV:TEST_KUSTOMIZE}
+    transformers:
+      - type: strategicMerge
+        path: ${ENV:TEST_PATCH}
+      - type: strategicMerge
+        path: patches/${ENV:TEST_PATCH_NAME}
+      - type: exec
+        command: ["${ENV:TEST_PLUGIN}", "${ENV:TEST_ARG}"]
+`)
+	dir := filepath.Dir(p)
+	t.Setenv("TEST_TOP_VALUES", "common.yaml")
+	t.Setenv("TEST_VALUES", "/abs/vals.yaml")
+	t.Setenv("TEST_REL_VALUES", "vals.yaml")
+	t.Setenv("TEST_KUSTOMIZE", "/abs/kust")
+	t.Setenv("TEST_PATCH", "/abs/patch.yaml")
+	t.Setenv("TEST_PATCH_NAME", "sidecar.yaml")
+	t.Setenv("TEST_PLUGIN", "./plugin")
+	t.Setenv("TEST_ARG", "./arg")
+
+	cfg, err := Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := cfg.Graphs[0]
+	want := []string{filepath.Join(dir, "common.yaml"), "/abs/vals.yaml", filepath.Join(dir, "vals.yaml")}
+	if strings.Join(g.ValuesFiles, " ") != strings.Join(want, " ") {
+		t.Errorf("valuesFiles = %v, want %v", g.ValuesFiles, want)
+	}
+	if g.Kustomize != "/abs/kust" {
+		t.Errorf("kustomize = %q", g.Kustomize)
+	}
+	if g.Transformers[0].Path != "/abs/patch.yaml" || g.Transformers[1].Path != filepath.Join(dir, "patches", "sidecar.yaml") {
+		t.Errorf("transformer paths = %q, %q", g.Transformers[0].Path, g.Transformers[1].Path)
+	}
+	if cmd := g.Transformers[2].Command; cmd[0] != filepath.Join(dir, "plugin") || cmd[1] != "./arg" {
+		t.Errorf("exec command = %v", cmd)
+	}
+
+	t.Setenv("TEST_KUSTOMIZE", "kust")
+	if cfg, err = Load(p); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Graphs[0].Kustomize; got != filepath.Join(dir, "kust") {
+		t.Errorf("relative kustomize = %q", got)
+	}
+}
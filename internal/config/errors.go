@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Error is a graphs.yaml problem tied to a source position.
+type Error struct {
+	File   string
+	Line   int
+	Column int
+	// Field is the dotted path of the offending value, e.g. graphs[1].image.tag.
+	Field string
+	Msg   string
+}
+
+func (e *Error) Error() string {
+	pos := e.File
+	if e.Line > 0 {
+		pos = fmt.Sprintf("%s:%d:%d", e.File, e.Line, e.Column)
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %s", pos, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s: %s", pos, e.Field, e.Msg)
+}
+
+func nodeError(file string, n *yaml.Node, field, format string, args ...any) *Error {
+	e := &Error{File: file, Field: field, Msg: fmt.Sprintf(format, args...)}
+	if n != nil {
+		e.Line, e.Column = n.Line, n.Column
+	}
+	return e
+}
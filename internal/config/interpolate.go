@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// interpRef matches ${ENV:NAME}, ${ENV:NAME:-default} and ${FILE:path}. A
+// leading $$ escapes the reference. Other ${...} strings, such as KRO schema
+// references, are left alone.
+var interpRef = regexp.MustCompile(`\$?\$\{(ENV|FILE):([^}]*)\}`)
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// hasRef reports whether s holds an ${ENV:...} or ${FILE:...} reference.
+func hasRef(s string) bool {
+	return (strings.Contains(s, "{ENV:") || strings.Contains(s, "{FILE:")) && interpRef.MatchString(s)
+}
+
+// interpolator expands references in the merged config, after the overlay is
+// chosen, so references in unused overlays are never resolved. Merged nodes
+// share their scalars with the files they were read from (see cloneNode), which
+// lets each reference resolve FILE paths against, and report errors in, its
+// own file, and be expanded exactly once.
+type interpolator struct {
+	origins map[*yaml.Node]string
+	done    map[*yaml.Node]bool
+	// paths rewrites the expansion of file references (see resolvePaths).
+	paths map[*yaml.Node]func(string) string
+}
+
+func newInterpolator() *interpolator {
+	return &interpolator{
+		origins: map[*yaml.Node]string{},
+		done:    map[*yaml.Node]bool{},
+		paths:   map[*yaml.Node]func(string) string{},
+	}
+}
+
+// deferPath reports whether n still holds a reference, in which case rewrite
+// is applied to its value once it is expanded instead of now.
+func (in *interpolator) deferPath(n *yaml.Node, rewrite func(string) string) bool {
+	if _, ok := in.origins[n]; !ok || in.done[n] {
+		return false
+	}
+	in.paths[n] = rewrite
+	return true
+}
+
+// record notes file as the origin of every scalar below n that holds a
+// reference.
+func (in *interpolator) record(file string, n *yaml.Node) {
+	if n.Kind == yaml.ScalarNode {
+		if hasRef(n.Value) {
+			in.origins[n] = file
+		}
+		return
+	}
+	for _, c := range n.Content {
+		in.record(file, c)
+	}
+}
+
+// expand resolves the references in every scalar value below n. FILE paths
+// are resolved relative to the directory of the scalar's file and their
+// content is trimmed of surrounding whitespace. An unquoted scalar takes the
+// type of its expanded text, as if it had been written out; a quoted one stays
+// a string.
+func (in *interpolator) expand(n *yaml.Node, field string) error {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if err := in.expand(n.Content[i+1], joinField(field, n.Content[i].Value)); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			if err := in.expand(c, fmt.Sprintf("%s[%d]", field, i)); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		file, ok := in.origins[n]
+		if !ok || in.done[n] {
+			return nil
+		}
+		in.done[n] = true
+		var firstErr error
+		out := interpRef.ReplaceAllStringFunc(n.Value, func(ref string) string {
+			if strings.HasPrefix(ref, "$$") {
+				return ref[1:]
+			}
+			m := interpRef.FindStringSubmatch(ref)
+			v, err := resolveRef(file, m[1], m[2])
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			return v
+		})
+		if firstErr != nil {
+			return nodeError(file, n, field, "%v", firstErr)
+		}
+		n.Value = out
+		if rewrite, ok := in.paths[n]; ok {
+			n.Value = rewrite(out)
+		}
+		if n.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			// Let the plain scalar resolve again from its new text.
+			n.Tag = ""
+		}
+	}
+	return nil
+}
+
+func resolveRef(file, kind, body string) (string, error) {
+	switch kind {
+	case "ENV":
+		name, def, hasDefault := strings.Cut(body, ":-")
+		if !envName.MatchString(name) {
+			return "", fmt.Errorf("invalid environment variable name %q", name)
+		}
+		v, ok := os.LookupEnv(name)
+		if hasDefault && v == "" {
+			// Like the shell's ${NAME:-default}, an empty value takes the default.
+			return def, nil
+		}
+		if ok {
+			return v, nil
+		}
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	default: // FILE
+		p := strings.TrimSpace(body)
+		if p == "" {
+			return "", fmt.Errorf("empty file reference")
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(filepath.Dir(file), p)
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return "", fmt.Errorf("read %s: %v", p, err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+}
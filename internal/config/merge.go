@@ -0,0 +1,238 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+// mergeNodes deep-merges src over base and returns a new node. Mappings merge
+// key by key; scalars and sequences in src replace whatever base holds. Neither
+// input is modified, and source positions are kept for error reporting.
+func mergeNodes(base, src *yaml.Node) *yaml.Node {
+	if base == nil {
+		return cloneSharingScalars(src)
+	}
+	if src == nil {
+		return cloneSharingScalars(base)
+	}
+	if base.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		return cloneSharingScalars(src)
+	}
+	out := cloneSharingScalars(base)
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, val := src.Content[i], src.Content[i+1]
+		if idx := util.MappingIndex(out, key.Value); idx >= 0 {
+			out.Content[idx+1] = mergeNodes(out.Content[idx+1], val)
+			continue
+		}
+		out.Content = append(out.Content, cloneSharingScalars(key), cloneSharingScalars(val))
+	}
+	return out
+}
+
+// cloneSharingScalars copies the mappings and sequences below n. Unlike
+// util.CloneNode it shares scalars rather than copying them, so references in them can be traced back to the file
+// they were read from and expanded in place once merging is done.
+func cloneSharingScalars(n *yaml.Node) *yaml.Node {
+	if n == nil || n.Kind == yaml.ScalarNode {
+		return n
+	}
+	c := *n
+	if n.Content != nil {
+		c.Content = make([]*yaml.Node, len(n.Content))
+		for i, child := range n.Content {
+			c.Content[i] = cloneSharingScalars(child)
+		}
+	}
+	return &c
+}
+
+// layer is one graphs file, or one overlay, reduced to the parts that merge.
+type layer struct {
+	valuesFiles []string
+	defaults    *yaml.Node
+	graphs      []graphEntry
+	overlays    map[string][]overlayEntry
+}
+
+// graphEntry is a graph node plus where it first appeared, for error reporting.
+type graphEntry struct {
+	service string
+	node    *yaml.Node
+	file    string
+	field   string
+}
+
+type overlayEntry struct {
+	node *yaml.Node
+	file string
+}
+
+// readLayer parses and validates a single graphs file and records its
+// interpolation references in in. Only the top-level valuesFiles, which always
+// apply, are expanded here; everything else is expanded by LoadFiles once the
+// overlay is chosen.
+func readLayer(path string, in *interpolator) (*layer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, &Error{File: path, Msg: err.Error()}
+	}
+	if len(doc.Content) == 0 {
+		return &layer{}, nil
+	}
+	top := doc.Content[0]
+	in.record(path, top)
+	if vf := util.MappingValue(top, "valuesFiles"); vf != nil {
+		if err := in.expand(vf, "valuesFiles"); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateNode(path, top, Schema(), ""); err != nil {
+		return nil, err
+	}
+	resolvePaths(filepath.Dir(path), top, in)
+	l, err := layerFrom(path, top, "")
+	if err != nil {
+		return nil, err
+	}
+	if vf := util.MappingValue(top, "valuesFiles"); vf != nil {
+		for _, f := range vf.Content {
+			l.valuesFiles = append(l.valuesFiles, f.Value)
+		}
+	}
+	if ov := util.MappingValue(top, "overlays"); ov != nil && ov.Kind == yaml.MappingNode {
+		l.overlays = map[string][]overlayEntry{}
+		for i := 0; i+1 < len(ov.Content); i += 2 {
+			env := ov.Content[i].Value
+			l.overlays[env] = append(l.overlays[env], overlayEntry{node: ov.Content[i+1], file: path})
+		}
+	}
+	return l, nil
+}
+
+// layerFrom extracts defaults and graph entries from a validated mapping.
+// Within one layer each service may appear only once.
+func layerFrom(file string, top *yaml.Node, fieldPrefix string) (*layer, error) {
+	l := &layer{defaults: util.MappingValue(top, "defaults")}
+	graphs := util.MappingValue(top, "graphs")
+	if graphs == nil || graphs.Kind != yaml.SequenceNode {
+		return l, nil
+	}
+	seen := map[string]*yaml.Node{}
+	for i, g := range graphs.Content {
+		field := fmt.Sprintf("%sgraphs[%d]", fieldPrefix, i)
+		svc := ""
+		if v := util.MappingValue(g, "service"); v != nil {
+			svc = v.Value
+		}
+		if first, dup := seen[svc]; dup {
+			return nil, nodeError(file, g, field, "duplicate service %q (first defined at line %d)", svc, first.Line)
+		}
+		seen[svc] = g
+		l.graphs = append(l.graphs, graphEntry{service: svc, node: g, file: file, field: field})
+	}
+	return l, nil
+}
+
+// apply merges next over l. Global valuesFiles accumulate, defaults deep-merge, graph entries are matched by
+// service and deep-merged (unmatched services are appended in order), and
+// overlays accumulate per environment name so they can be applied in the
+// same order later.
+func (l *layer) apply(next *layer) {
+	l.valuesFiles = append(l.valuesFiles, next.valuesFiles...)
+	l.defaults = mergeNodes(l.defaults, next.defaults)
+	for _, g := range next.graphs {
+		matched := false
+		for i := range l.graphs {
+			if l.graphs[i].service == g.service {
+				l.graphs[i].node = mergeNodes(l.graphs[i].node, g.node)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			l.graphs = append(l.graphs, g)
+		}
+	}
+	for env, ovs := range next.overlays {
+		if l.overlays == nil {
+			l.overlays = map[string][]overlayEntry{}
+		}
+		l.overlays[env] = append(l.overlays[env], ovs...)
+	}
+}
+
+// envs returns the overlay names in sorted order.
+func (l *layer) envs() []string {
+	out := make([]string, 0, len(l.overlays))
+	for env := range l.overlays {
+		out = append(out, env)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// resolvePaths rewrites relative file references in a graphs file (valuesFiles
+// entries, kustomize directories, transformer patch paths and ./ or ../ exec
+// commands) at the top level, in defaults, graphs and overlays to paths rooted
+// at dir, so they stay correct once files from different directories are merged.
+// References holding ${ENV:...} or ${FILE:...} are left for in to rewrite once
+// they are expanded, so only the expanded path is judged relative.
+func resolvePaths(dir string, root *yaml.Node, in *interpolator) {
+	rebase := func(v string) string {
+		if v != "" && !filepath.IsAbs(v) {
+			return filepath.Join(dir, v)
+		}
+		return v
+	}
+	rebaseCommand := func(v string) string {
+		if strings.HasPrefix(v, "./") || strings.HasPrefix(v, "../") {
+			return rebase(v)
+		}
+		return v
+	}
+	rewrite := func(n *yaml.Node, fn func(string) string) {
+		if n == nil || n.Kind != yaml.ScalarNode || in.deferPath(n, fn) {
+			return
+		}
+		n.Value = fn(n.Value)
+	}
+	resolve := func(owner *yaml.Node) {
+		if vf := util.MappingValue(owner, "valuesFiles"); vf != nil && vf.Kind == yaml.SequenceNode {
+			for _, f := range vf.Content {
+				rewrite(f, rebase)
+			}
+		}
+		rewrite(util.MappingValue(owner, "kustomize"), rebase)
+		if ts := util.MappingValue(owner, "transformers"); ts != nil && ts.Kind == yaml.SequenceNode {
+			for _, t := range ts.Content {
+				rewrite(util.MappingValue(t, "path"), rebase)
+				if cmd := util.MappingValue(t, "command"); cmd != nil && cmd.Kind == yaml.SequenceNode && len(cmd.Content) > 0 {
+					rewrite(cmd.Content[0], rebaseCommand)
+				}
+			}
+		}
+	}
+	resolve(root)
+	resolve(util.MappingValue(root, "defaults"))
+	if graphs := util.MappingValue(root, "graphs"); graphs != nil {
+		for _, g := range graphs.Content {
+			resolve(g)
+		}
+	}
+	if ov := util.MappingValue(root, "overlays"); ov != nil && ov.Kind == yaml.MappingNode {
+		for i := 1; i < len(ov.Content); i += 2 {
+			resolvePaths(dir, ov.Content[i], in)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SchemaID is the draft used for the published graphs.yaml schema.
+const SchemaID = "http://json-schema.org/draft-07/schema#"
+
+// Schema returns the JSON Schema for graphs.yaml, derived from Root and its
+// `yaml`, `desc` and `jsonschema` struct tags. Load validates against the same
+// document, so editors and the CLI agree on what is accepted.
+func Schema() map[string]any {
+	s := schemaFor(reflect.TypeOf(Root{}), true)
+	s["$schema"] = SchemaID
+	s["title"] = "ack-kro-gen graphs.yaml"
+	s["description"] = "Services and settings used to generate KRO ResourceGraphDefinitions for ACK controllers."
+	return s
+}
+
+// SchemaJSON returns Schema encoded as indented JSON with a trailing newline.
+func SchemaJSON() ([]byte, error) {
+	b, err := json.MarshalIndent(Schema(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func schemaFor(t reflect.Type, withRequired bool) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		props := map[string]any{}
+		var required []string
+		for _, f := range schemaFields(t) {
+			opts := parseSchemaTag(f.field.Tag.Get("jsonschema"))
+			child := schemaFor(f.field.Type, withRequired && !opts.partial)
+			if d := f.field.Tag.Get("desc"); d != "" {
+				child["description"] = d
+			}
+			if len(opts.types) > 0 {
+				child["type"] = schemaType(opts.types)
+			}
+			if len(opts.enum) > 0 {
+				child["type"] = "string"
+				child["enum"] = opts.enum
+			}
+			if opts.minItems > 0 {
+				child["minItems"] = opts.minItems
+			}
+			if opts.required && withRequired {
+				required = append(required, f.name)
+			}
+			props[f.name] = child
+		}
+		s := map[string]any{
+			"type":                 "object",
+			"properties":           props,
+			"additionalProperties": false,
+		}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem(), withRequired)}
+	case reflect.Map:
+		s := map[string]any{"type": "object"}
+		if t.Elem().Kind() != reflect.Interface {
+			s["additionalProperties"] = schemaFor(t.Elem(), withRequired)
+		}
+		return s
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		// Unquoted numbers such as `version: 1.2` decode to their text as written.
+		return map[string]any{"type": []string{"string", "number"}}
+	default:
+		return map[string]any{}
+	}
+}
+
+func schemaType(types []string) any {
+	if len(types) == 1 {
+		return types[0]
+	}
+	return types
+}
+
+type schemaField struct {
+	name  string
+	field reflect.StructField
+}
+
+// schemaFields lists the exported fields of t with their yaml keys, in
+// declaration order.
+func schemaFields(t reflect.Type) []schemaField {
+	var out []schemaField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		out = append(out, schemaField{name: name, field: sf})
+	}
+	return out
+}
+
+type schemaTag struct {
+	required bool
+	partial  bool
+	types    []string
+	enum     []string
+	minItems int
+}
+
+func parseSchemaTag(tag string) schemaTag {
+	var o schemaTag
+	for _, part := range strings.Split(tag, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "required":
+			o.required = true
+		case "partial":
+			o.partial = true
+		case "type":
+			o.types = strings.Split(val, "|")
+		case "enum":
+			o.enum = strings.Split(val, "|")
+		case "minItems":
+			o.minItems, _ = strconv.Atoi(val)
+		}
+	}
+	return o
+}
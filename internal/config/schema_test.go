@@ -0,0 +1,51 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestSchemaFileUpToDate(t *testing.T) {
+	want, err := SchemaJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("../../graphs.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("graphs.schema.json is stale; regenerate with: go run ./cmd/ack-kro-gen config schema > graphs.schema.json")
+	}
+}
+
+func TestLoadValidatesEnum(t *testing.T) {
+	p := writeGraphs(t, `graphs:
+  - service: s3
+    version: "1.1.1"
+    controller:
+      logLevel: verbose
+`)
+	_, err := Load(p)
+	cerr, ok := err.(*Error)
+	if !ok || cerr.Field != "graphs[0].controller.logLevel" || cerr.Line != 5 || cerr.Column != 17 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadAcceptsUnquotedNumbers(t *testing.T) {
+	p := writeGraphs(t, `graphs:
+  - service: s3
+    version: 1.10
+    aws:
+      accountID: 111122223333
+`)
+	cfg, err := Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := cfg.Graphs[0]; g.Version != "1.10" || g.AWS.AccountID != "111122223333" {
+		t.Fatalf("version=%q accountID=%q", g.Version, g.AWS.AccountID)
+	}
+}
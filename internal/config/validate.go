@@ -0,0 +1,254 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+// validateNode checks n against the subset of JSON Schema emitted by Schema:
+// type, enum, properties, required, additionalProperties, items and minItems.
+// Errors point at the offending node's line and column.
+func validateNode(file string, n *yaml.Node, s map[string]any, field string) error {
+	if n == nil {
+		return nil
+	}
+	if n.Kind == yaml.AliasNode {
+		return validateNode(file, n.Alias, s, field)
+	}
+	if isNull(n) {
+		return nil
+	}
+	if n.Kind == yaml.ScalarNode && hasRef(n.Value) {
+		// Checked once the reference is expanded.
+		return nil
+	}
+
+	if want := schemaTypes(s["type"]); len(want) > 0 {
+		got := nodeType(n)
+		if !typeAllowed(got, want) {
+			return nodeError(file, n, field, "expected %s, got %s", strings.Join(want, " or "), kindName(n))
+		}
+	}
+	if enum, ok := s["enum"].([]string); ok {
+		if !contains(enum, n.Value) {
+			return nodeError(file, n, field, "%q is not one of %s", n.Value, strings.Join(enum, ", "))
+		}
+	}
+
+	switch n.Kind {
+	case yaml.MappingNode:
+		props, _ := s["properties"].(map[string]any)
+		for _, req := range requiredKeys(s) {
+			if util.MappingIndex(n, req) < 0 {
+				return nodeError(file, n, field, "%s is required", req)
+			}
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, val := n.Content[i], n.Content[i+1]
+			child := joinField(field, key.Value)
+			if ps, ok := props[key.Value].(map[string]any); ok {
+				if err := validateNode(file, val, ps, child); err != nil {
+					return err
+				}
+				continue
+			}
+			switch ap := s["additionalProperties"].(type) {
+			case bool:
+				if !ap {
+					return nodeError(file, key, field, "unknown field %q", key.Value)
+				}
+			case map[string]any:
+				if err := validateNode(file, val, ap, child); err != nil {
+					return err
+				}
+			}
+		}
+	case yaml.SequenceNode:
+		if minItems, ok := s["minItems"].(int); ok && len(n.Content) < minItems {
+			return nodeError(file, n, field, "at least %d item(s) required", minItems)
+		}
+		if items, ok := s["items"].(map[string]any); ok {
+			for i, item := range n.Content {
+				if err := validateNode(file, item, items, fmt.Sprintf("%s[%d]", field, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func schemaTypes(v any) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	}
+	return nil
+}
+
+// nodeType maps a YAML node to its JSON Schema type name.
+func nodeType(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+	switch n.ShortTag() {
+	case "!!int":
+		return "integer"
+	case "!!float":
+		return "number"
+	case "!!bool":
+		return "boolean"
+	case "!!null":
+		return "null"
+	}
+	return "string"
+}
+
+func typeAllowed(got string, want []string) bool {
+	for _, w := range want {
+		if w == got || (w == "number" && got == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func requiredKeys(s map[string]any) []string {
+	req, _ := s["required"].([]string)
+	return req
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func joinField(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+func isNull(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.ShortTag() == "!!null"
+}
+
+func kindName(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	case yaml.ScalarNode:
+		return fmt.Sprintf("%s %q", nodeType(n), n.Value)
+	default:
+		return "an unsupported node"
+	}
+}
+
+// checkTransformers reports transformer entries whose fields do not fit their
+// type, which the schema alone cannot express.
+func checkTransformers(file string, graph *yaml.Node, field string, ts []TransformerSpec) error {
+	seq := util.MappingValue(graph, "transformers")
+	for i, t := range ts {
+		n, f := graph, joinField(field, fmt.Sprintf("transformers[%d]", i))
+		if seq != nil && i < len(seq.Content) {
+			n = seq.Content[i]
+		}
+		hasPatch := t.Patch != "" || t.Path != ""
+		switch t.Type {
+		case TransformerJSON6902, TransformerStrategicMerge:
+			if t.Patch != "" && t.Path != "" {
+				return nodeError(file, n, f, "set only one of patch and path")
+			}
+			if !hasPatch {
+				return nodeError(file, n, f, "%s needs patch or path", t.Type)
+			}
+			if len(t.Command) > 0 {
+				return nodeError(file, n, f, "command is only valid for exec")
+			}
+			if t.Type == TransformerJSON6902 && t.Target == (TargetSpec{}) {
+				return nodeError(file, n, f, "json6902 needs a target")
+			}
+		case TransformerExec:
+			if len(t.Command) == 0 {
+				return nodeError(file, n, f, "exec needs command")
+			}
+			if hasPatch {
+				return nodeError(file, n, f, "patch and path are not valid for exec")
+			}
+		}
+	}
+	return nil
+}
+
+func checkClassification(file string, graph *yaml.Node, field string, rules []ClassifyRule) error {
+	seq := util.MappingValue(graph, "classification")
+	for i, r := range rules {
+		n, f := graph, joinField(field, fmt.Sprintf("classification[%d]", i))
+		if seq != nil && i < len(seq.Content) {
+			n = seq.Content[i]
+		}
+		for _, pattern := range []string{r.APIGroup, r.Kind, r.Name} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nodeError(file, n, f, "bad pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkAuth(file string, graph *yaml.Node, field string, gs GraphSpec) error {
+	n := util.MappingValue(util.MappingValue(graph, "aws"), "auth")
+	if n == nil {
+		n = graph
+	}
+	if gs.AWS.Auth.ClusterName != "" && gs.AWS.Auth.Mode != AuthModePodIdentity {
+		return nodeError(file, n, joinField(field, "aws.auth"), "clusterName is only valid with mode podIdentity")
+	}
+	if gs.IAMRole.Create && gs.AWS.Auth.Mode == AuthModeSecret {
+		return nodeError(file, n, joinField(field, "aws.auth"), "iamRole.create is not valid with mode secret")
+	}
+	return nil
+}
+
+var accountID = regexp.MustCompile(`^[0-9]{12}$`)
+
+// checkCARM rejects malformed account IDs and role ARNs in carm.accounts.
+func checkCARM(file string, graph *yaml.Node, field string, c CARMSpec) error {
+	accNode := util.MappingValue(util.MappingValue(graph, "carm"), "accounts")
+	ids := make([]string, 0, len(c.Accounts))
+	for id := range c.Accounts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		n, f := graph, joinField(field, "carm.accounts."+id)
+		if i := util.MappingIndex(accNode, id); i >= 0 {
+			n = accNode.Content[i]
+		}
+		if !accountID.MatchString(id) {
+			return nodeError(file, n, f, "%q is not a 12-digit AWS account ID", id)
+		}
+		if arn := c.Accounts[id]; !strings.HasPrefix(arn, "arn:") {
+			return nodeError(file, n, f, "role %q is not an ARN", arn)
+		}
+	}
+	return nil
+}
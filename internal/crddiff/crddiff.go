@@ -0,0 +1,361 @@
+// Package crddiff compares the CustomResourceDefinitions shipped by two chart
+// versions and classifies each difference as breaking or not for existing
+// custom resources and their clients.
+package crddiff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/util"
+)
+
+// CRD is the part of a CustomResourceDefinition that is compared.
+type CRD struct {
+	Name     string
+	Scope    string
+	Versions []Version
+}
+
+// Version is one entry of spec.versions.
+type Version struct {
+	Name    string
+	Served  bool
+	Storage bool
+	Schema  map[string]any
+}
+
+type crdDoc struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Scope    string `yaml:"scope"`
+		Versions []struct {
+			Name    string `yaml:"name"`
+			Served  bool   `yaml:"served"`
+			Storage bool   `yaml:"storage"`
+			Schema  struct {
+				OpenAPIV3Schema map[string]any `yaml:"openAPIV3Schema"`
+			} `yaml:"schema"`
+		} `yaml:"versions"`
+	} `yaml:"spec"`
+}
+
+// Set maps CRD names to their definitions.
+type Set map[string]CRD
+
+// FromChart reads the CRDs in the chart's crds/ directories.
+func FromChart(ch *chart.Chart) (Set, error) {
+	s := Set{}
+	for _, obj := range ch.CRDObjects() {
+		if err := s.Add(obj.Filename, string(obj.File.Data)); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Add parses the CRDs in the YAML stream data, read from file. Documents of
+// other kinds are ignored.
+func (s Set) Add(file, data string) error {
+	for i, doc := range util.SplitYAML(data) {
+		var d crdDoc
+		if err := yaml.Unmarshal([]byte(doc), &d); err != nil {
+			return fmt.Errorf("%s (document %d): %w", file, i, err)
+		}
+		if d.Kind != "CustomResourceDefinition" {
+			continue
+		}
+		c := CRD{Name: d.Metadata.Name, Scope: d.Spec.Scope}
+		for _, v := range d.Spec.Versions {
+			c.Versions = append(c.Versions, Version{Name: v.Name, Served: v.Served, Storage: v.Storage, Schema: v.Schema.OpenAPIV3Schema})
+		}
+		s[c.Name] = c
+	}
+	return nil
+}
+
+// Change is one difference between two versions of a CRD.
+type Change struct {
+	CRD string
+	// Version is the CRD version the change applies to, empty for changes to
+	// the CRD as a whole.
+	Version string
+	// Path locates a schema change, e.g. spec.tags[*].key, with .* for map
+	// values.
+	Path     string
+	Message  string
+	Breaking bool
+}
+
+func (c Change) String() string {
+	where := c.CRD
+	if c.Version != "" {
+		where += " " + c.Version
+	}
+	if c.Path != "" {
+		where += " " + c.Path
+	}
+	return where + ": " + c.Message
+}
+
+// Compare lists the changes from before to after, sorted by CRD and version,
+// with schema changes in field order.
+func Compare(before, after Set) []Change {
+	var changes []Change
+	for _, name := range names(before, after) {
+		a, inA := before[name]
+		b, inB := after[name]
+		switch {
+		case !inB:
+			changes = append(changes, Change{CRD: name, Message: "CRD removed", Breaking: true})
+		case !inA:
+			changes = append(changes, Change{CRD: name, Message: "CRD added"})
+		default:
+			changes = append(changes, compareCRD(a, b)...)
+		}
+	}
+	return changes
+}
+
+// Breaking counts the breaking changes.
+func Breaking(changes []Change) int {
+	n := 0
+	for _, c := range changes {
+		if c.Breaking {
+			n++
+		}
+	}
+	return n
+}
+
+func compareCRD(a, b CRD) []Change {
+	var changes []Change
+	add := func(version, path, msg string, breaking bool) {
+		changes = append(changes, Change{CRD: a.Name, Version: version, Path: path, Message: msg, Breaking: breaking})
+	}
+	if a.Scope != b.Scope {
+		add("", "", fmt.Sprintf("scope changed from %s to %s", a.Scope, b.Scope), true)
+	}
+	if sa, sb := storageVersion(a), storageVersion(b); sa != sb {
+		add("", "", fmt.Sprintf("storage version changed from %s to %s", sa, sb), true)
+	}
+
+	bv := map[string]Version{}
+	for _, v := range b.Versions {
+		bv[v.Name] = v
+	}
+	for _, va := range a.Versions {
+		vb, ok := bv[va.Name]
+		delete(bv, va.Name)
+		switch {
+		case !ok && va.Served:
+			add(va.Name, "", "served version removed", true)
+			continue
+		case !ok:
+			add(va.Name, "", "unserved version removed", false)
+			continue
+		case va.Served && !vb.Served:
+			add(va.Name, "", "version no longer served", true)
+		case !va.Served && vb.Served:
+			add(va.Name, "", "version now served", false)
+		}
+		compareSchema("", va.Schema, vb.Schema, func(path, msg string, breaking bool) {
+			add(va.Name, path, msg, breaking)
+		})
+	}
+	for _, v := range b.Versions {
+		if _, ok := bv[v.Name]; ok {
+			add(v.Name, "", "version added", false)
+		}
+	}
+	return changes
+}
+
+func storageVersion(c CRD) string {
+	for _, v := range c.Versions {
+		if v.Storage {
+			return v.Name
+		}
+	}
+	return ""
+}
+
+// Bounds a schema node may set. Lowering an upper bound or raising a lower
+// bound rejects values that were valid before.
+var (
+	upperBounds = []string{"maximum", "maxLength", "maxItems", "maxProperties"}
+	lowerBounds = []string{"minimum", "minLength", "minItems", "minProperties"}
+)
+
+// compareSchema walks the OpenAPI schemas a and b in step and reports each
+// difference at path through add.
+func compareSchema(path string, a, b map[string]any, add func(path, msg string, breaking bool)) {
+	if ta, tb := str(a["type"]), str(b["type"]); ta != tb {
+		switch {
+		case ta == "integer" && tb == "number", tb == "":
+			add(path, fmt.Sprintf("type widened from %s to %s", orAny(ta), orAny(tb)), false)
+		default:
+			add(path, fmt.Sprintf("type changed from %s to %s", orAny(ta), orAny(tb)), true)
+		}
+	}
+	const preserve = "x-kubernetes-preserve-unknown-fields"
+	if pa, pb := a[preserve] == true, b[preserve] == true; pa != pb {
+		if pa {
+			add(path, "unknown fields no longer preserved", true)
+		} else {
+			add(path, "unknown fields now preserved", false)
+		}
+	}
+	if fa, fb := str(a["format"]), str(b["format"]); fa != fb {
+		add(path, fmt.Sprintf("format changed from %q to %q", fa, fb), fb != "")
+	}
+	if pa, pb := str(a["pattern"]), str(b["pattern"]); pa != pb {
+		add(path, fmt.Sprintf("pattern changed from %q to %q", pa, pb), pb != "")
+	}
+	for _, k := range upperBounds {
+		compareBound(path, k, a[k], b[k], func(x, y float64) bool { return y < x }, add)
+	}
+	for _, k := range lowerBounds {
+		compareBound(path, k, a[k], b[k], func(x, y float64) bool { return y > x }, add)
+	}
+
+	ea, eb := strs(a["enum"]), strs(b["enum"])
+	if len(ea) > 0 || len(eb) > 0 {
+		if removed := minus(ea, eb); len(eb) > 0 && len(removed) > 0 {
+			add(path, "enum values removed: "+strings.Join(removed, ", "), true)
+		}
+		if added := minus(eb, ea); len(ea) > 0 && len(added) > 0 {
+			add(path, "enum values added: "+strings.Join(added, ", "), false)
+		}
+		if len(ea) == 0 {
+			add(path, "enum added", true)
+		}
+		if len(eb) == 0 {
+			add(path, "enum removed", false)
+		}
+	}
+
+	ra, rb := strs(a["required"]), strs(b["required"])
+	for _, f := range minus(rb, ra) {
+		add(join(path, f), "field now required", true)
+	}
+	for _, f := range minus(ra, rb) {
+		add(join(path, f), "field no longer required", false)
+	}
+
+	pa, pb := mapping(a["properties"]), mapping(b["properties"])
+	for _, k := range names(pa, pb) {
+		ca, inA := pa[k]
+		cb, inB := pb[k]
+		switch {
+		case !inB:
+			add(join(path, k), "field removed", true)
+		case !inA:
+			add(join(path, k), "field added", false)
+		default:
+			compareSchema(join(path, k), mapping(ca), mapping(cb), add)
+		}
+	}
+	if ia, ib := mapping(a["items"]), mapping(b["items"]); ia != nil && ib != nil {
+		compareSchema(path+"[*]", ia, ib, add)
+	}
+	if aa, ab := mapping(a["additionalProperties"]), mapping(b["additionalProperties"]); aa != nil && ab != nil {
+		compareSchema(join(path, "*"), aa, ab, add)
+	}
+}
+
+// compareBound reports a change to the bound key. tighter reports whether
+// moving the bound from x to y rejects values that were valid.
+func compareBound(path, key string, a, b any, tighter func(x, y float64) bool, add func(path, msg string, breaking bool)) {
+	x, okA := number(a)
+	y, okB := number(b)
+	switch {
+	case !okA && !okB, okA && okB && x == y:
+	case !okA:
+		add(path, fmt.Sprintf("%s %v added", key, b), true)
+	case !okB:
+		add(path, fmt.Sprintf("%s %v removed", key, a), false)
+	default:
+		add(path, fmt.Sprintf("%s changed from %v to %v", key, a, b), tighter(x, y))
+	}
+}
+
+func names[V any](maps ...map[string]V) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				out = append(out, k)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func mapping(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
+
+func str(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func strs(v any) []string {
+	list, _ := v.([]any)
+	out := make([]string, 0, len(list))
+	for _, e := range list {
+		out = append(out, fmt.Sprint(e))
+	}
+	return out
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func orAny(t string) string {
+	if t == "" {
+		return "any"
+	}
+	return t
+}
+
+// minus returns the entries of a not in b.
+func minus(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[s] = true
+	}
+	var out []string
+	for _, s := range a {
+		if !in[s] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+package crddiff
+
+import (
+	"strings"
+	"testing"
+)
+
+const bucketsV1 = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata: {name: buckets.s3.services.k8s.aws}
+spec:
+  scope: Namespaced
+  versions:
+    - name: v1alpha1
+      served: true
+      storage: true
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec:
+              type: object
+              required: [name]
+              properties:
+                name: {type: string, maxLength: 63}
+                acl: {type: string, enum: [private, public-read]}
+                tags:
+                  type: array
+                  items:
+                    type: object
+                    properties:
+                      key: {type: string}
+                      value: {type: string}
+                size: {type: integer}
+`
+
+const bucketsV2 = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata: {name: buckets.s3.services.k8s.aws}
+spec:
+  scope: Namespaced
+  versions:
+    - name: v1alpha1
+      served: false
+      storage: false
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec:
+              type: object
+              required: [name, region]
+              properties:
+                name: {type: string, maxLength: 255}
+                acl: {type: string, enum: [private]}
+                tags:
+                  type: array
+                  items:
+                    type: object
+                    properties:
+                      key: {type: integer}
+                size: {type: number}
+                region: {type: string}
+    - name: v1
+      served: true
+      storage: true
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata: {name: policies.s3.services.k8s.aws}
+spec: {scope: Namespaced}
+`
+
+func TestCompare(t *testing.T) {
+	before, after := Set{}, Set{}
+	if err := before.Add("crds/buckets.yaml", bucketsV1); err != nil {
+		t.Fatal(err)
+	}
+	if err := after.Add("crds/buckets.yaml", bucketsV2); err != nil {
+		t.Fatal(err)
+	}
+	changes := Compare(before, after)
+
+	var got []string
+	for _, c := range changes {
+		mark := " "
+		if c.Breaking {
+			mark = "!"
+		}
+		got = append(got, mark+" "+c.String())
+	}
+	want := []string{
+		"! buckets.s3.services.k8s.aws: storage version changed from v1alpha1 to v1",
+		"! buckets.s3.services.k8s.aws v1alpha1: version no longer served",
+		"! buckets.s3.services.k8s.aws v1alpha1 spec.region: field now required",
+		"! buckets.s3.services.k8s.aws v1alpha1 spec.acl: enum values removed: public-read",
+		"  buckets.s3.services.k8s.aws v1alpha1 spec.name: maxLength changed from 63 to 255",
+		"  buckets.s3.services.k8s.aws v1alpha1 spec.region: field added",
+		"  buckets.s3.services.k8s.aws v1alpha1 spec.size: type widened from integer to number",
+		"! buckets.s3.services.k8s.aws v1alpha1 spec.tags[*].key: type changed from string to integer",
+		"! buckets.s3.services.k8s.aws v1alpha1 spec.tags[*].value: field removed",
+		"  buckets.s3.services.k8s.aws v1: version added",
+		"  policies.s3.services.k8s.aws: CRD added",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("changes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if n := Breaking(changes); n != 6 {
+		t.Fatalf("breaking = %d", n)
+	}
+	if len(Compare(after, after)) != 0 {
+		t.Fatal("identical sets differ")
+	}
+}
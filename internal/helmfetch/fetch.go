@@ -10,6 +10,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/jayadeyemi/ack-kro-gen/internal/util"
+
 	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/downloader"
 	"helm.sh/helm/v3/pkg/getter"
@@ -57,7 +59,12 @@ func EnsureChart(ctx context.Context, chartRef, cacheDir string, offline bool) (
 		return "", fmt.Errorf("offline mode and chart not cached: %s", archive)
 	}
 	log.Printf("helmfetch: downloading %s to %s", chartRef, archive)
-	if _, _, err := cd.DownloadTo(name, version, pwd); err != nil {
+	// The downloader takes no context; stop waiting on it once ctx is done.
+	err = util.Await(ctx, func() error {
+		_, _, err := cd.DownloadTo(name, version, pwd)
+		return err
+	})
+	if err != nil {
 		return "", fmt.Errorf("download: %w", err)
 	}
 	if _, err := os.Stat(archive); err != nil {
@@ -0,0 +1,25 @@
+package kro
+
+// carmID is the resource ID of the CARM account map.
+const carmID = "carmAccountMap"
+
+// carmResource builds the ack-role-account-map ConfigMap CARM reads the role
+// for each account from, in the controller's namespace. Its data is the
+// schema's carm.accounts, defaulted from graphs.yaml, and it is only created
+// while enableCARM is true and carm.accounts is not empty, so instances can
+// turn CARM on whatever graphs.yaml configured.
+func carmResource() (Resource, error) {
+	t, err := templateNode(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]any{
+			"name":      "ack-role-account-map",
+			"namespace": "${schema.spec.namespace}",
+		},
+		"data": "${schema.spec.carm.accounts}",
+	})
+	if err != nil {
+		return Resource{}, err
+	}
+	return Resource{ID: carmID, Template: t, IncludeWhen: []string{"${schema.spec.enableCARM}", "${size(schema.spec.carm.accounts) > 0}"}}, nil
+}
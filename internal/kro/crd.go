@@ -1,37 +1,218 @@
 package kro
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"log"
+	"sort"
 	"strings"
 
 	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
 	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+	"github.com/jayadeyemi/ack-kro-gen/internal/util"
 	"gopkg.in/yaml.v3"
 )
 
-// Build CRD resources from CRD objects.
-func buildCRDResources(list []classify.Obj) ([]Resource, error) {
+// buildCRDResources builds CRD resources from CRD objects, slimmed as spec
+// asks. When spec.MaxBytes is set and exceeded, the slimming steps not already
+// enabled are applied in turn; it fails if the CRDs still do not fit.
+func buildCRDResources(service string, list []classify.Obj, spec config.CRDsSpec) ([]Resource, error) {
+	if spec.StripDescriptions {
+		for _, o := range list {
+			stripDescriptions(o.Node)
+		}
+	}
+	if spec.ServedVersionsOnly {
+		for _, o := range list {
+			dropUnservedVersions(o.Node)
+		}
+	}
+	if spec.MaxBytes > 0 {
+		steps := []struct {
+			enabled bool
+			name    string
+			apply   func(*yaml.Node)
+		}{
+			{spec.StripDescriptions, "stripped descriptions", stripDescriptions},
+			{spec.ServedVersionsOnly, "dropped non-served versions", dropUnservedVersions},
+		}
+		sizes := objSizes(list)
+		for _, step := range steps {
+			if sizes.total() <= spec.MaxBytes || step.enabled {
+				continue
+			}
+			before := sizes.total()
+			for _, o := range list {
+				step.apply(o.Node)
+			}
+			sizes = objSizes(list)
+			log.Printf("[%s] crds: %s to fit crds.maxBytes (%d): %d -> %d bytes", service, step.name, spec.MaxBytes, before, sizes.total())
+		}
+		if sizes.total() > spec.MaxBytes {
+			return nil, fmt.Errorf("CRDs are %d bytes after slimming, over crds.maxBytes (%d); largest: %s", sizes.total(), spec.MaxBytes, sizes.top(3))
+		}
+	}
+
 	res := make([]Resource, 0, len(list))
 	seen := map[string]int{}
 	for _, o := range list {
-		var m map[string]any
-		if err := yaml.Unmarshal([]byte(o.RawYAML), &m); err != nil {
-			return nil, err
-		}
 		base := o.Name
 		if idx := strings.Index(base, "."); idx > 0 {
 			base = base[:idx]
 		}
-		id := "graph-" + makeID(base)
+		id := makeID(base)
 		seen[id]++
 		if seen[id] > 1 {
-			id = fmt.Sprintf("%s-%d", id, seen[id])
+			id = fmt.Sprintf("%s%d", id, seen[id])
 		}
-		res = append(res, Resource{ID: id, Template: m})
+		res = append(res, Resource{ID: id, Template: o.Node})
 	}
 	return res, nil
 }
 
+// stripDescriptions removes description keywords from every schema of crd
+// and from its printer columns. Fields named "description" are kept.
+func stripDescriptions(crd *yaml.Node) {
+	spec := util.MappingValue(crd, "spec")
+	stripSchemaDescriptions(util.MappingValue(util.MappingValue(spec, "validation"), "openAPIV3Schema"))
+	for _, v := range items(util.MappingValue(spec, "versions")) {
+		stripSchemaDescriptions(util.MappingValue(util.MappingValue(v, "schema"), "openAPIV3Schema"))
+		for _, col := range items(util.MappingValue(v, "additionalPrinterColumns")) {
+			deleteKey(col, "description")
+		}
+	}
+	for _, col := range items(util.MappingValue(spec, "additionalPrinterColumns")) {
+		deleteKey(col, "description")
+	}
+}
+
+func stripSchemaDescriptions(schema *yaml.Node) {
+	if schema == nil || schema.Kind != yaml.MappingNode {
+		return
+	}
+	deleteKey(schema, "description")
+	for i := 0; i+1 < len(schema.Content); i += 2 {
+		v := schema.Content[i+1]
+		switch schema.Content[i].Value {
+		case "properties", "patternProperties", "definitions", "dependencies":
+			// Keys are field names; the values are schemas.
+			if v.Kind == yaml.MappingNode {
+				for j := 1; j < len(v.Content); j += 2 {
+					stripSchemaDescriptions(v.Content[j])
+				}
+			}
+		case "allOf", "anyOf", "oneOf":
+			for _, s := range v.Content {
+				stripSchemaDescriptions(s)
+			}
+		case "items", "additionalItems":
+			if v.Kind == yaml.SequenceNode {
+				for _, s := range v.Content {
+					stripSchemaDescriptions(s)
+				}
+			} else {
+				stripSchemaDescriptions(v)
+			}
+		case "additionalProperties", "not":
+			stripSchemaDescriptions(v)
+		}
+	}
+}
+
+// dropUnservedVersions removes the versions of crd that are not served,
+// keeping the storage version.
+func dropUnservedVersions(crd *yaml.Node) {
+	versions := util.MappingValue(util.MappingValue(crd, "spec"), "versions")
+	if versions == nil || versions.Kind != yaml.SequenceNode {
+		return
+	}
+	kept := versions.Content[:0]
+	for _, v := range versions.Content {
+		if scalarValue(util.MappingValue(v, "served")) == "true" || scalarValue(util.MappingValue(v, "storage")) == "true" {
+			kept = append(kept, v)
+		}
+	}
+	versions.Content = kept
+}
+
+func deleteKey(m *yaml.Node, key string) {
+	if i := util.MappingIndex(m, key); i >= 0 {
+		m.Content = append(m.Content[:i], m.Content[i+2:]...)
+	}
+}
+
+// sizedObj is an object and its encoded size in bytes.
+type sizedObj struct {
+	name  string
+	bytes int
+}
+
+type sizes []sizedObj
+
+// objSizes measures each object as encoded into an RGD, largest first.
+func objSizes(list []classify.Obj) sizes {
+	out := make(sizes, 0, len(list))
+	for _, o := range list {
+		out = append(out, sizedObj{name: o.Name, bytes: encodedSize(o.Node)})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].bytes > out[j].bytes })
+	return out
+}
+
+// resourceSizes measures each resource template, named by ID, largest first.
+func resourceSizes(list []Resource) sizes {
+	out := make(sizes, 0, len(list))
+	for _, r := range list {
+		out = append(out, sizedObj{name: r.ID, bytes: encodedSize(r.Template)})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].bytes > out[j].bytes })
+	return out
+}
+
+func (s sizes) total() int {
+	n := 0
+	for _, o := range s {
+		n += o.bytes
+	}
+	return n
+}
+
+// top formats the n largest objects for messages.
+func (s sizes) top(n int) string {
+	parts := make([]string, 0, n)
+	for _, o := range s[:min(n, len(s))] {
+		parts = append(parts, fmt.Sprintf("%s (%d bytes)", o.name, o.bytes))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// encodedSize is the size of n encoded the way writeYAML encodes it, as a
+// resource template indented four spaces under spec.resources.
+func encodedSize(n *yaml.Node) int {
+	cw := &countingWriter{w: io.Discard}
+	enc := yaml.NewEncoder(cw)
+	enc.SetIndent(2)
+	if err := enc.Encode(n); err != nil {
+		return 0
+	}
+	enc.Close()
+	return int(cw.n + 4*cw.lines)
+}
+
+type countingWriter struct {
+	w     io.Writer
+	n     int64
+	lines int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.lines += int64(bytes.Count(p[:n], []byte{'\n'}))
+	return n, err
+}
+
 // MakeCRDsRGD assembles the CRDs RGD for a service.
 func MakeCRDsRGD(gs config.GraphSpec, serviceUpper string, crdResources []Resource) RGD {
 	return RGD{
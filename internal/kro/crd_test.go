@@ -0,0 +1,73 @@
+package kro
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+)
+
+const testCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata: {name: buckets.s3.services.k8s.aws}
+spec:
+  versions:
+    - name: v1alpha1
+      served: false
+      storage: false
+    - name: v1
+      served: true
+      storage: true
+      additionalPrinterColumns:
+        - {name: ARN, type: string, description: The bucket ARN, jsonPath: .status.arn}
+      schema:
+        openAPIV3Schema:
+          description: Bucket is the Schema for the Buckets API
+          type: object
+          properties:
+            description:
+              description: A field that happens to be called description.
+              type: string
+            tags:
+              type: array
+              items:
+                description: A tag.
+                type: object
+`
+
+func TestBuildCRDResourcesSlimming(t *testing.T) {
+	objs := []classify.Obj{parseObj(t, testCRD)}
+	if _, err := buildCRDResources("s3", objs, config.CRDsSpec{StripDescriptions: true, ServedVersionsOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := objs[0].YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(out, "description") != 1 || !regexp.MustCompile(`description:\n\s+type: string`).MatchString(out) {
+		t.Fatalf("descriptions not stripped, or the description field was lost:\n%s", out)
+	}
+	if strings.Contains(out, "v1alpha1") || !strings.Contains(out, "name: v1\n") {
+		t.Fatalf("unserved version not dropped:\n%s", out)
+	}
+
+	// The cap applies the remaining steps, then fails naming the largest CRD.
+	objs = []classify.Obj{parseObj(t, testCRD)}
+	full := encodedSize(objs[0].Node)
+	if _, err := buildCRDResources("s3", objs, config.CRDsSpec{MaxBytes: full - 1}); err != nil {
+		t.Fatalf("stripping descriptions should fit under %d bytes: %v", full-1, err)
+	}
+	_, err = buildCRDResources("s3", []classify.Obj{parseObj(t, testCRD)}, config.CRDsSpec{MaxBytes: 100})
+	if err == nil || !strings.Contains(err.Error(), "largest: buckets.s3.services.k8s.aws (") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestClassifyRulesPinCRDs(t *testing.T) {
+	groups := classifyRules([]config.ClassifyRule{{Kind: "*", Group: classify.GroupOthers}}).Classify([]classify.Obj{parseObj(t, testCRD)})
+	if len(groups.CRDs) != 1 || len(groups.Others) != 0 {
+		t.Fatalf("broad rule moved the CRD: %+v", groups)
+	}
+}
@@ -0,0 +1,155 @@
+package kro
+
+import (
+	"log"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+	"github.com/jayadeyemi/ack-kro-gen/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+// credentialsID is the resource ID of the generated AWS credentials Secret.
+const credentialsID = "awsCredentials"
+
+// Where the credentials Secret is mounted in controller containers.
+const (
+	credentialsVolume    = "aws-credentials"
+	credentialsMountPath = "/var/run/secrets/aws"
+)
+
+// includeWhen conditions selecting whether the credentials are mounted.
+const (
+	credentialsMounted   = "${schema.spec.aws.credentials.mount}"
+	credentialsUnmounted = "${!schema.spec.aws.credentials.mount}"
+)
+
+// credentialsResource builds the Secret holding the shared credentials file.
+// It is created only when the schema's aws.credentials.mount and
+// aws.credentials.create are true; otherwise the Deployment mounts an existing
+// Secret named by aws.credentials.secretName. KRO cannot template keys, so the
+// file is stored under the key configured at generation time.
+func credentialsResource(gs config.GraphSpec) (Resource, error) {
+	t, err := templateNode(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]any{
+			"name":      "${schema.spec.aws.credentials.secretName}",
+			"namespace": "${schema.spec.namespace}",
+		},
+		"type": "Opaque",
+		"stringData": map[string]any{
+			credentialsKey(gs): "${schema.spec.aws.credentials.content}",
+		},
+	})
+	if err != nil {
+		return Resource{}, err
+	}
+	return Resource{ID: credentialsID, Template: t, IncludeWhen: []string{credentialsMounted, "${schema.spec.aws.credentials.create}"}}, nil
+}
+
+// credentialsKey is the Secret key holding the shared credentials file.
+func credentialsKey(gs config.GraphSpec) string {
+	if gs.AWS.Credentials != "" {
+		return gs.AWS.Credentials
+	}
+	return "credentials"
+}
+
+// mountCredentials adds, after every Deployment in objs, a copy wired to the
+// credentials Secret: an optional secret volume, a read-only mount in each
+// container, and AWS_SHARED_CREDENTIALS_FILE and AWS_PROFILE pointing the SDK
+// at it. Values the chart already rendered under the same names are replaced.
+// The copy is included while the schema's aws.credentials.mount is true and
+// the original while it is false; the conditions are returned keyed by
+// template node. The file is read from the key the generated Secret uses
+// while aws.credentials.create is true, and from aws.credentials.secretKey in
+// an existing Secret otherwise.
+func mountCredentials(gs config.GraphSpec, objs []classify.Obj) ([]classify.Obj, map[*yaml.Node][]string, error) {
+	file := credentialsMountPath + `/${schema.spec.aws.credentials.create ? "` + credentialsKey(gs) + `" : schema.spec.aws.credentials.secretKey}`
+	when := map[*yaml.Node][]string{}
+	out := make([]classify.Obj, 0, len(objs)+1)
+	for _, o := range objs {
+		out = append(out, o)
+		if o.Kind != "Deployment" || podSpec(o) == nil {
+			continue
+		}
+		wired := o
+		wired.Node = util.CloneNode(o.Node)
+		spec := podSpec(wired)
+		err := setNamed(ensureSequence(spec, "volumes"), credentialsVolume, map[string]any{
+			"name": credentialsVolume,
+			"secret": map[string]any{
+				"secretName": "${schema.spec.aws.credentials.secretName}",
+				"optional":   true,
+			},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, c := range items(util.MappingValue(spec, "containers")) {
+			err := setNamed(ensureSequence(c, "volumeMounts"), credentialsVolume, map[string]any{
+				"name":      credentialsVolume,
+				"mountPath": credentialsMountPath,
+				"readOnly":  true,
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			env := ensureSequence(c, "env")
+			err = setNamed(env, "AWS_SHARED_CREDENTIALS_FILE", map[string]any{
+				"name":  "AWS_SHARED_CREDENTIALS_FILE",
+				"value": file,
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			err = setNamed(env, "AWS_PROFILE", map[string]any{
+				"name":  "AWS_PROFILE",
+				"value": "${schema.spec.aws.credentials.profile}",
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		when[o.Node] = []string{credentialsUnmounted}
+		when[wired.Node] = []string{credentialsMounted}
+		out = append(out, wired)
+	}
+	if len(when) == 0 {
+		log.Printf("[%s] credentials: no Deployment found to mount the credentials Secret into", gs.Service)
+	}
+	return out, when, nil
+}
+
+// ensureSequence returns the sequence stored under key in m, adding an empty
+// one if key is missing or not a sequence.
+func ensureSequence(m *yaml.Node, key string) *yaml.Node {
+	if v := util.MappingValue(m, key); v != nil && v.Kind == yaml.SequenceNode {
+		return v
+	}
+	v := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	if i := util.MappingIndex(m, key); i >= 0 {
+		m.Content[i+1] = v
+		return v
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+	return v
+}
+
+// setNamed replaces the entry of seq whose name is name with item, or
+// appends item if there is none.
+func setNamed(seq *yaml.Node, name string, item map[string]any) error {
+	n, err := templateNode(item)
+	if err != nil {
+		return err
+	}
+	for i, e := range seq.Content {
+		if scalarValue(util.MappingValue(e, "name")) == name {
+			seq.Content[i] = n
+			return nil
+		}
+	}
+	seq.Content = append(seq.Content, n)
+	return nil
+}
@@ -2,42 +2,37 @@ package kro
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
 	"github.com/jayadeyemi/ack-kro-gen/internal/config"
 	"github.com/jayadeyemi/ack-kro-gen/internal/placeholders"
-	"gopkg.in/yaml.v3"
 )
 
-// Build controller-side resources from non-CRD objects.
-func buildControllerResources(list []classify.Obj) ([]Resource, error) {
+// Build controller-side resources from non-CRD objects. References between the
+// objects become ${<id>.metadata.name} expressions and the resources are
+// ordered so each follows the resources it references.
+func buildControllerResources(list []classify.Obj) ([]Resource, int) {
 	res := make([]Resource, 0, len(list))
 	seen := map[string]int{}
 	for _, o := range list {
-		var m map[string]any
-		if err := yaml.Unmarshal([]byte(o.RawYAML), &m); err != nil {
-			return nil, err
-		}
-		id := controllerIDForKind(o.Kind)
+		id := makeID(o.Kind)
 		seen[id]++
 		if seen[id] > 1 {
-			id = fmt.Sprintf("%s-%d", id, seen[id])
+			id = fmt.Sprintf("%s%d", id, seen[id])
 		}
-		res = append(res, Resource{ID: id, Template: m})
+		res = append(res, Resource{ID: id, Template: o.Node})
 	}
-	return res, nil
-}
-
-func controllerIDForKind(kind string) string {
-	k := strings.ToLower(strings.TrimSpace(kind))
-	return "graph-" + makeID(k)
+	return linkResources(list, res)
 }
 
 // MakeCtrlRGD assembles the controller RGD for a service.
-func MakeCtrlRGD(gs config.GraphSpec, serviceUpper string, ctrlResources []Resource) RGD {
-	// Add a graph-crd item as the first resource in the controller graph.
-	ctrlResources = append([]Resource{makeGraphCRDItem(gs.Service, serviceUpper)}, ctrlResources...)
+func MakeCtrlRGD(gs config.GraphSpec, serviceUpper string, ctrlResources []Resource) (RGD, error) {
+	// Add the CRD graph as the first resource in the controller graph.
+	crdGraph, err := makeGraphCRDItem(gs.Service, serviceUpper)
+	if err != nil {
+		return RGD{}, err
+	}
+	ctrlResources = append([]Resource{crdGraph}, ctrlResources...)
 
 	// Assemble the RGD object.
 	return RGD{
@@ -51,7 +46,7 @@ func MakeCtrlRGD(gs config.GraphSpec, serviceUpper string, ctrlResources []Resou
 			Schema:    CtrlSchema(gs, serviceUpper),
 			Resources: ctrlResources,
 		},
-	}
+	}, nil
 }
 
 // CtrlSchema assembles the schema for controller graphs using shared placeholders.
@@ -68,19 +63,20 @@ func CtrlSchema(gs config.GraphSpec, serviceUpper string) Schema {
 	}
 }
 
-// define the graph-crd item to be added to the controller resources
-func makeGraphCRDItem(service string, serviceUpper string) Resource {
-	return Resource{
-		ID: "graph-" + service + "-crds",
-		Template: map[string]any{
-			"apiVersion": "kro.run/v1alpha1",
-			"kind":       serviceUpper + "crdgraph",
-			"metadata": map[string]any{
-				"name": "${schema.spec.name}-crd-graph",
-			},
-			"spec": map[string]any{
-				"name": "${schema.spec.name}-crd-graph",
-			},
+// define the CRD graph item to be added to the controller resources
+func makeGraphCRDItem(service string, serviceUpper string) (Resource, error) {
+	t, err := templateNode(map[string]any{
+		"apiVersion": "kro.run/v1alpha1",
+		"kind":       serviceUpper + "crdgraph",
+		"metadata": map[string]any{
+			"name": "${schema.spec.name}-crd-graph",
+		},
+		"spec": map[string]any{
+			"name": "${schema.spec.name}-crd-graph",
 		},
+	})
+	if err != nil {
+		return Resource{}, err
 	}
+	return Resource{ID: makeID(service + "-crds"), Template: t}, nil
 }
@@ -0,0 +1,125 @@
+package kro
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+)
+
+// testHook marks objects from templates/tests/ and helm.sh/hook: test.
+const testHook = "test"
+
+// hookPlan holds the hook objects pulled out of a render, by destination.
+type hookPlan struct {
+	// Pre and Post are converted hooks placed before and after the other controller resources.
+	Pre, Post []classify.Obj
+	// Separate holds hooks and tests for the <service>-hooks RGD.
+	Separate []classify.Obj
+}
+
+// planHooks removes Helm hooks and tests from objs and sorts them into a hookPlan
+// according to policy. It logs what happens to each one and returns the remaining objects.
+func planHooks(service, policy string, objs []classify.Obj) ([]classify.Obj, hookPlan, error) {
+	var rest []classify.Obj
+	var plan hookPlan
+	for _, o := range objs {
+		if len(o.Hooks) == 0 {
+			rest = append(rest, o)
+			continue
+		}
+		phases := strings.Join(o.Hooks, ",")
+		switch policy {
+		case "", config.HookPolicyDrop:
+			log.Printf("[%s] hooks: drop %s/%s (%s)", service, o.Kind, o.Name, phases)
+		case config.HookPolicySeparate:
+			log.Printf("[%s] hooks: separate %s/%s (%s)", service, o.Kind, o.Name, phases)
+			plan.Separate = append(plan.Separate, o)
+		case config.HookPolicyConvert:
+			switch {
+			case hasHook(o, "pre-install", "pre-upgrade"):
+				log.Printf("[%s] hooks: convert %s/%s (%s) before controller resources", service, o.Kind, o.Name, phases)
+				plan.Pre = append(plan.Pre, o)
+			case hasHook(o, "post-install", "post-upgrade"):
+				log.Printf("[%s] hooks: convert %s/%s (%s) after controller resources", service, o.Kind, o.Name, phases)
+				plan.Post = append(plan.Post, o)
+			default:
+				log.Printf("[%s] hooks: drop %s/%s (%s), no install/upgrade phase", service, o.Kind, o.Name, phases)
+			}
+		default:
+			return nil, hookPlan{}, fmt.Errorf("unknown hooks policy %q", policy)
+		}
+	}
+	sortHooks(plan.Pre)
+	sortHooks(plan.Post)
+	sortHooks(plan.Separate)
+	return rest, plan, nil
+}
+
+func hasHook(o classify.Obj, phases ...string) bool {
+	for _, h := range o.Hooks {
+		for _, p := range phases {
+			if h == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sortHooks orders hooks the way Helm runs them: by weight, then kind and name.
+func sortHooks(list []classify.Obj) {
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.HookWeight != b.HookWeight {
+			return a.HookWeight < b.HookWeight
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+}
+
+// splitSeparated takes the hooks in separate back out of transformed objs,
+// matching them by kind, namespace and name. Transformers may re-parse objects,
+// so the hook phases and weight planned for them are restored.
+func splitSeparated(objs, separate []classify.Obj) (rest, hooks []classify.Obj) {
+	key := func(o classify.Obj) string { return o.Kind + "/" + o.Namespace + "/" + o.Name }
+	planned := make(map[string]classify.Obj, len(separate))
+	for _, o := range separate {
+		planned[key(o)] = o
+	}
+	for _, o := range objs {
+		h, ok := planned[key(o)]
+		if !ok {
+			rest = append(rest, o)
+			continue
+		}
+		o.Hooks, o.HookWeight = h.Hooks, h.HookWeight
+		hooks = append(hooks, o)
+	}
+	sortHooks(hooks)
+	return rest, hooks
+}
+
+// MakeHooksRGD assembles the RGD holding a service's hooks and tests under the separate policy.
+func MakeHooksRGD(gs config.GraphSpec, serviceUpper string, hookResources []Resource) RGD {
+	schema := CtrlSchema(gs, serviceUpper)
+	schema.Kind = serviceUpper + "hookgraph"
+	return RGD{
+		APIVersion: "kro.run/v1alpha1",
+		Kind:       "ResourceGraphDefinition",
+		Metadata: Metadata{
+			Name:      fmt.Sprintf("ack-%s-hooks.kro.run", gs.Service),
+			Namespace: "kro",
+		},
+		Spec: RGDSpec{
+			Schema:    schema,
+			Resources: hookResources,
+		},
+	}
+}
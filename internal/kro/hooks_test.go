@@ -0,0 +1,99 @@
+package kro
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+	"github.com/jayadeyemi/ack-kro-gen/internal/render"
+)
+
+func TestPlanHooks(t *testing.T) {
+	objs := []classify.Obj{
+		{Kind: "Deployment", Name: "ctrl"},
+		{Kind: "Job", Name: "migrate", Hooks: []string{"pre-install", "pre-upgrade"}, HookWeight: 5},
+		{Kind: "ConfigMap", Name: "seed", Hooks: []string{"pre-install"}, HookWeight: -1},
+		{Kind: "Job", Name: "notify", Hooks: []string{"post-install"}},
+		{Kind: "Job", Name: "cleanup", Hooks: []string{"pre-delete"}},
+		{Kind: "Pod", Name: "smoke", Hooks: []string{testHook}},
+	}
+
+	rest, plan, err := planHooks("s3", config.HookPolicyConvert, objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 || rest[0].Name != "ctrl" {
+		t.Fatalf("rest = %v, want only the deployment", rest)
+	}
+	if got := names(plan.Pre); got != "seed,migrate" {
+		t.Errorf("pre = %s, want seed,migrate", got)
+	}
+	if got := names(plan.Post); got != "notify" {
+		t.Errorf("post = %s, want notify", got)
+	}
+	if len(plan.Separate) != 0 {
+		t.Errorf("separate = %v, want none", plan.Separate)
+	}
+
+	_, plan, err = planHooks("s3", config.HookPolicySeparate, objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Separate) != 5 || len(plan.Pre)+len(plan.Post) != 0 {
+		t.Errorf("separate plan = %+v, want all five hooks separated", plan)
+	}
+
+	rest, plan, err = planHooks("s3", config.HookPolicyDrop, objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 || len(plan.Pre)+len(plan.Post)+len(plan.Separate) != 0 {
+		t.Errorf("drop kept hooks: rest=%v plan=%+v", rest, plan)
+	}
+}
+
+func TestEmitRGDsHooksFile(t *testing.T) {
+	r := &render.Result{RenderedFiles: map[string]string{
+		"s3-chart/templates/deployment.yaml":  "apiVersion: apps/v1\nkind: Deployment\nmetadata: {name: ctrl}\n",
+		"s3-chart/templates/tests/smoke.yaml": "apiVersion: v1\nkind: Pod\nmetadata: {name: smoke}\n",
+	}}
+	gs := config.GraphSpec{Service: "s3", Version: "1.0.0", Hooks: config.HooksSpec{Policy: config.HookPolicySeparate},
+		Transformers: []config.TransformerSpec{{Type: "json6902", Target: config.TargetSpec{Kind: "Pod"},
+			Patch: `[{"op": "add", "path": "/metadata/labels", "value": {"patched": "yes"}}]`}}}
+	out := t.TempDir()
+	if _, err := EmitRGDs(context.Background(), gs, r, out); err != nil {
+		t.Fatal(err)
+	}
+	hooksPath := filepath.Join(out, "ack", "s3-hooks.yaml")
+	data, err := os.ReadFile(hooksPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "kind: S3hookgraph") || !strings.Contains(string(data), "patched: yes") {
+		t.Fatalf("hooks RGD missing schema kind or transformer patch:\n%s", data)
+	}
+
+	gs.Hooks.Policy = config.HookPolicyDrop
+	gs.Transformers = nil
+	if _, err := EmitRGDs(context.Background(), gs, r, out); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(hooksPath); !os.IsNotExist(err) {
+		t.Fatalf("stale hooks RGD not removed: %v", err)
+	}
+}
+
+func names(list []classify.Obj) string {
+	s := ""
+	for i, o := range list {
+		if i > 0 {
+			s += ","
+		}
+		s += o.Name
+	}
+	return s
+}
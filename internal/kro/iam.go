@@ -0,0 +1,236 @@
+package kro
+
+import (
+	"log"
+	"strings"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+	"github.com/jayadeyemi/ack-kro-gen/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+// Resource IDs of the generated IAM role and pod identity association. The
+// service account annotation and the association refer to the role by ID.
+const (
+	iamRoleID     = "iamRole"
+	podIdentityID = "podIdentityAssociation"
+	iamRoleARN    = "${" + iamRoleID + ".status.ackResourceMetadata.arn}"
+)
+
+// irsaAnnotation is the service account annotation EKS reads the IRSA role from.
+const irsaAnnotation = "eks.amazonaws.com/role-arn"
+
+// recommendedPolicyARNs holds the managed policy each ACK controller
+// recommends in its config/iam/recommended-policy-arn. Controllers that ship
+// an inline policy instead are not listed.
+var recommendedPolicyARNs = map[string][]string{
+	"acm":               {"arn:aws:iam::aws:policy/AWSCertificateManagerFullAccess"},
+	"apigatewayv2":      {"arn:aws:iam::aws:policy/AmazonAPIGatewayAdministrator"},
+	"cloudfront":        {"arn:aws:iam::aws:policy/CloudFrontFullAccess"},
+	"cloudtrail":        {"arn:aws:iam::aws:policy/AWSCloudTrail_FullAccess"},
+	"cloudwatchlogs":    {"arn:aws:iam::aws:policy/CloudWatchLogsFullAccess"},
+	"codeartifact":      {"arn:aws:iam::aws:policy/AWSCodeArtifactAdminAccess"},
+	"documentdb":        {"arn:aws:iam::aws:policy/AmazonDocDBFullAccess"},
+	"dynamodb":          {"arn:aws:iam::aws:policy/AmazonDynamoDBFullAccess"},
+	"ec2":               {"arn:aws:iam::aws:policy/AmazonEC2FullAccess"},
+	"ecr":               {"arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryFullAccess"},
+	"ecs":               {"arn:aws:iam::aws:policy/AmazonECS_FullAccess"},
+	"efs":               {"arn:aws:iam::aws:policy/AmazonElasticFileSystemFullAccess"},
+	"elasticache":       {"arn:aws:iam::aws:policy/AmazonElastiCacheFullAccess"},
+	"elbv2":             {"arn:aws:iam::aws:policy/ElasticLoadBalancingFullAccess"},
+	"eventbridge":       {"arn:aws:iam::aws:policy/AmazonEventBridgeFullAccess"},
+	"iam":               {"arn:aws:iam::aws:policy/IAMFullAccess"},
+	"kafka":             {"arn:aws:iam::aws:policy/AmazonMSKFullAccess"},
+	"keyspaces":         {"arn:aws:iam::aws:policy/AmazonKeyspacesFullAccess"},
+	"lambda":            {"arn:aws:iam::aws:policy/AWSLambda_FullAccess"},
+	"memorydb":          {"arn:aws:iam::aws:policy/AmazonMemoryDBFullAccess"},
+	"mq":                {"arn:aws:iam::aws:policy/AmazonMQFullAccess"},
+	"opensearchservice": {"arn:aws:iam::aws:policy/AmazonOpenSearchServiceFullAccess"},
+	"pipes":             {"arn:aws:iam::aws:policy/AmazonEventBridgePipesFullAccess"},
+	"prometheusservice": {"arn:aws:iam::aws:policy/AmazonPrometheusFullAccess"},
+	"rds":               {"arn:aws:iam::aws:policy/AmazonRDSFullAccess"},
+	"route53":           {"arn:aws:iam::aws:policy/AmazonRoute53FullAccess"},
+	"route53resolver":   {"arn:aws:iam::aws:policy/AmazonRoute53ResolverFullAccess"},
+	"s3":                {"arn:aws:iam::aws:policy/AmazonS3FullAccess"},
+	"sagemaker":         {"arn:aws:iam::aws:policy/AmazonSageMakerFullAccess"},
+	"secretsmanager":    {"arn:aws:iam::aws:policy/SecretsManagerReadWrite"},
+	"sfn":               {"arn:aws:iam::aws:policy/AWSStepFunctionsFullAccess"},
+	"sns":               {"arn:aws:iam::aws:policy/AmazonSNSFullAccess"},
+	"sqs":               {"arn:aws:iam::aws:policy/AmazonSQSFullAccess"},
+	"ssm":               {"arn:aws:iam::aws:policy/AmazonSSMFullAccess"},
+}
+
+// podIdentityTrustPolicy lets EKS Pod Identity assume the role on behalf of
+// the pods it is associated with.
+const podIdentityTrustPolicy = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow",` +
+	`"Principal":{"Service":"pods.eks.amazonaws.com"},` +
+	`"Action":["sts:AssumeRole","sts:TagSession"]}]}`
+
+// irsaTrustPolicy lets the controller's service account assume the role
+// through the cluster's OIDC provider.
+const irsaTrustPolicy = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow",` +
+	`"Principal":{"Federated":"arn:aws:iam::${schema.spec.aws.accountID}:oidc-provider/${schema.spec.iamRole.oidcProvider}"},` +
+	`"Action":"sts:AssumeRoleWithWebIdentity",` +
+	`"Condition":{"StringEquals":{` +
+	`"${schema.spec.iamRole.oidcProvider}:sub":"system:serviceaccount:${schema.spec.namespace}:${schema.spec.serviceAccount.name}",` +
+	`"${schema.spec.iamRole.oidcProvider}:aud":"sts.amazonaws.com"}}}]}`
+
+// policyARNs returns the managed policies for the generated role: the graph's
+// own list, or the service's recommended policy.
+func policyARNs(gs config.GraphSpec) []string {
+	if len(gs.IAMRole.PolicyARNs) > 0 {
+		return gs.IAMRole.PolicyARNs
+	}
+	arns := recommendedPolicyARNs[strings.ToLower(gs.Service)]
+	if len(arns) == 0 {
+		log.Printf("[%s] iam: no recommended managed policy for this service; set iamRole.policyARNs", gs.Service)
+	}
+	return arns
+}
+
+// authResources returns the resources gs.AWS.Auth.Mode calls for and wires
+// the controller objects in objs to them: IAM resources for the service
+// account, or a credentials Secret, which the Deployment variants from
+// mountCredentials read.
+func authResources(gs config.GraphSpec, objs []classify.Obj) ([]Resource, error) {
+	switch gs.AWS.Auth.Mode {
+	case config.AuthModePodIdentity:
+		// Pod Identity credentials take precedence, but a stale IRSA
+		// annotation would still make the SDK try web identity first.
+		for _, sa := range workloadServiceAccounts(objs) {
+			ann := util.MappingValue(util.MappingValue(sa.Node, "metadata"), "annotations")
+			if i := util.MappingIndex(ann, irsaAnnotation); i >= 0 {
+				ann.Content = append(ann.Content[:i], ann.Content[i+2:]...)
+			}
+		}
+		role, err := iamRoleResource(gs)
+		if err != nil {
+			return nil, err
+		}
+		assoc, err := podIdentityResource()
+		if err != nil {
+			return nil, err
+		}
+		return []Resource{role, assoc}, nil
+	case config.AuthModeSecret:
+		// EmitRGDs wires the Deployments with mountCredentials.
+		secret, err := credentialsResource(gs)
+		if err != nil {
+			return nil, err
+		}
+		return []Resource{secret}, nil
+	}
+	if !gs.IAMRole.Create {
+		return nil, nil
+	}
+	sas := workloadServiceAccounts(objs)
+	if len(sas) == 0 {
+		log.Printf("[%s] iam: no workload service account found to annotate with the role ARN", gs.Service)
+	}
+	for _, sa := range sas {
+		setScalar(ensureMapping(util.MappingValue(sa.Node, "metadata"), "annotations"), irsaAnnotation, iamRoleARN)
+	}
+	role, err := iamRoleResource(gs)
+	if err != nil {
+		return nil, err
+	}
+	return []Resource{role}, nil
+}
+
+// iamRoleResource builds the ACK IAM Role the controller runs as, trusted by
+// IRSA or by EKS Pod Identity depending on the auth mode.
+func iamRoleResource(gs config.GraphSpec) (Resource, error) {
+	trust := irsaTrustPolicy
+	if gs.AWS.Auth.Mode == config.AuthModePodIdentity {
+		trust = podIdentityTrustPolicy
+	}
+	spec := map[string]any{
+		"name":                     "${schema.spec.name}",
+		"description":              "${schema.spec.iamRole.roleDescription}",
+		"maxSessionDuration":       "${schema.spec.iamRole.maxSessionDuration}",
+		"assumeRolePolicyDocument": trust,
+	}
+	if arns := policyARNs(gs); len(arns) > 0 {
+		spec["policies"] = arns
+	}
+	t, err := templateNode(map[string]any{
+		"apiVersion": "iam.services.k8s.aws/v1alpha1",
+		"kind":       "Role",
+		"metadata": map[string]any{
+			"name":      "${schema.spec.name}",
+			"namespace": "${schema.spec.namespace}",
+		},
+		"spec": spec,
+	})
+	if err != nil {
+		return Resource{}, err
+	}
+	return Resource{ID: iamRoleID, Template: t}, nil
+}
+
+// podIdentityResource associates the controller's service account with the
+// generated role.
+func podIdentityResource() (Resource, error) {
+	t, err := templateNode(map[string]any{
+		"apiVersion": "eks.services.k8s.aws/v1alpha1",
+		"kind":       "PodIdentityAssociation",
+		"metadata": map[string]any{
+			"name":      "${schema.spec.name}",
+			"namespace": "${schema.spec.namespace}",
+		},
+		"spec": map[string]any{
+			"clusterName":    "${schema.spec.podIdentity.clusterName}",
+			"namespace":      "${schema.spec.namespace}",
+			"serviceAccount": "${schema.spec.serviceAccount.name}",
+			"roleARN":        iamRoleARN,
+		},
+	})
+	if err != nil {
+		return Resource{}, err
+	}
+	return Resource{ID: podIdentityID, Template: t}, nil
+}
+
+// workloadServiceAccounts returns the service accounts in objs that a
+// workload in objs runs as.
+func workloadServiceAccounts(objs []classify.Obj) []classify.Obj {
+	used := map[string]bool{}
+	for _, o := range objs {
+		if sa := scalarValue(util.MappingValue(podSpec(o), "serviceAccountName")); sa != "" {
+			used[sa] = true
+		}
+	}
+	var out []classify.Obj
+	for _, o := range objs {
+		if o.Kind == "ServiceAccount" && used[o.Name] && util.MappingValue(o.Node, "metadata") != nil {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// ensureMapping returns the mapping stored under key in m, adding an empty
+// one if key is missing or not a mapping.
+func ensureMapping(m *yaml.Node, key string) *yaml.Node {
+	if v := util.MappingValue(m, key); v != nil && v.Kind == yaml.MappingNode {
+		return v
+	}
+	v := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if i := util.MappingIndex(m, key); i >= 0 {
+		m.Content[i+1] = v
+		return v
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+	return v
+}
+
+// setScalar sets key in mapping m to the string value, adding it if missing.
+func setScalar(m *yaml.Node, key, value string) {
+	v := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+	if i := util.MappingIndex(m, key); i >= 0 {
+		m.Content[i+1] = v
+		return
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+}
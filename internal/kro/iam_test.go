@@ -0,0 +1,163 @@
+package kro
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+	"github.com/jayadeyemi/ack-kro-gen/internal/util"
+)
+
+func authObjs(t *testing.T) []classify.Obj {
+	t.Helper()
+	return []classify.Obj{
+		parseObj(t, "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: ctrl\n  annotations:\n    eks.amazonaws.com/role-arn: arn:aws:iam::111122223333:role/old\n"),
+		parseObj(t, "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: other\n"),
+		parseObj(t, "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: d\nspec:\n  template:\n    spec:\n      serviceAccountName: ctrl\n"),
+	}
+}
+
+func ids(res []Resource) string {
+	var out []string
+	for _, r := range res {
+		out = append(out, r.ID)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestAuthResourcesIRSA(t *testing.T) {
+	objs := authObjs(t)
+	gs := config.GraphSpec{Service: "s3", AWS: config.AWSSpec{Auth: config.AuthSpec{Mode: config.AuthModeIRSA}}}
+	if res, err := authResources(gs, objs); err != nil || len(res) != 0 {
+		t.Fatalf("resources without iamRole.create = %s, %v", ids(res), err)
+	}
+
+	gs.IAMRole.Create = true
+	res, err := authResources(gs, objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(res); got != "iamRole" {
+		t.Fatalf("resources = %s, want iamRole", got)
+	}
+	sa, _ := objs[0].YAML()
+	if !strings.Contains(sa, "eks.amazonaws.com/role-arn: ${iamRole.status.ackResourceMetadata.arn}") {
+		t.Errorf("service account not annotated:\n%s", sa)
+	}
+	if other, _ := objs[1].YAML(); strings.Contains(other, "role-arn") {
+		t.Errorf("unused service account annotated:\n%s", other)
+	}
+	if got := scalarValue(items(util.MappingValue(util.MappingValue(res[0].Template, "spec"), "policies"))[0]); got != "arn:aws:iam::aws:policy/AmazonS3FullAccess" {
+		t.Errorf("policy = %s", got)
+	}
+
+	gs.IAMRole.PolicyARNs = []string{"arn:aws:iam::111122223333:policy/s3-ack"}
+	custom, err := iamRoleResource(gs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := scalarValue(items(util.MappingValue(util.MappingValue(custom.Template, "spec"), "policies"))[0]); got != "arn:aws:iam::111122223333:policy/s3-ack" {
+		t.Errorf("custom policy = %s", got)
+	}
+}
+
+func TestAuthResourcesPodIdentity(t *testing.T) {
+	objs := authObjs(t)
+	gs := config.GraphSpec{Service: "s3", AWS: config.AWSSpec{Auth: config.AuthSpec{Mode: config.AuthModePodIdentity}}}
+	res, err := authResources(gs, objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(res); got != "iamRole,podIdentityAssociation" {
+		t.Fatalf("resources = %s", got)
+	}
+	if sa, _ := objs[0].YAML(); strings.Contains(sa, "role-arn") {
+		t.Errorf("IRSA annotation kept:\n%s", sa)
+	}
+	trust := scalarValue(util.MappingValue(util.MappingValue(res[0].Template, "spec"), "assumeRolePolicyDocument"))
+	if !strings.Contains(trust, "pods.eks.amazonaws.com") {
+		t.Errorf("trust policy = %s", trust)
+	}
+	if got := scalarValue(util.MappingValue(util.MappingValue(res[1].Template, "spec"), "roleARN")); got != "${iamRole.status.ackResourceMetadata.arn}" {
+		t.Errorf("roleARN = %s", got)
+	}
+
+	clusterName := func() any {
+		return CtrlSchema(gs, "S3").Spec.Values["podIdentity"].(map[string]any)["clusterName"]
+	}
+	if got := clusterName(); got != "string | required=true" {
+		t.Errorf("clusterName without a default = %v", got)
+	}
+	gs.AWS.Auth.ClusterName = "prod"
+	if got := clusterName(); got != "string | default=prod" {
+		t.Errorf("clusterName = %v", got)
+	}
+}
+
+func TestAuthResourcesSecret(t *testing.T) {
+	objs := append(authObjs(t), parseObj(t, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: chart
+spec:
+  template:
+    spec:
+      containers:
+        - name: controller
+          env:
+            - name: AWS_PROFILE
+              value: from-chart
+`))
+	gs := config.GraphSpec{Service: "s3", AWS: config.AWSSpec{Auth: config.AuthSpec{Mode: config.AuthModeSecret}}}
+	res, err := authResources(gs, objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(res); got != "awsCredentials" {
+		t.Fatalf("resources = %s", got)
+	}
+	if got := strings.Join(res[0].IncludeWhen, ","); got != "${schema.spec.aws.credentials.mount},${schema.spec.aws.credentials.create}" {
+		t.Errorf("includeWhen = %s", got)
+	}
+	out, when, err := mountCredentials(gs, objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each Deployment is followed by its wired copy.
+	if len(out) != len(objs)+2 {
+		t.Fatalf("got %d objects, want %d", len(out), len(objs)+2)
+	}
+	if got := strings.Join(when[out[4].Node], ","); got != "${!schema.spec.aws.credentials.mount}" {
+		t.Errorf("original includeWhen = %s", got)
+	}
+	if got := strings.Join(when[out[5].Node], ","); got != "${schema.spec.aws.credentials.mount}" {
+		t.Errorf("wired includeWhen = %s", got)
+	}
+	if orig, _ := out[4].YAML(); strings.Contains(orig, credentialsVolume) {
+		t.Errorf("original deployment was wired:\n%s", orig)
+	}
+	dep, _ := out[5].YAML()
+	for _, want := range []string{
+		"secretName: ${schema.spec.aws.credentials.secretName}",
+		"mountPath: /var/run/secrets/aws",
+		`value: '/var/run/secrets/aws/${schema.spec.aws.credentials.create ? "credentials" : schema.spec.aws.credentials.secretKey}'`,
+		"value: ${schema.spec.aws.credentials.profile}",
+	} {
+		if !strings.Contains(dep, want) {
+			t.Errorf("deployment missing %q:\n%s", want, dep)
+		}
+	}
+	if strings.Contains(dep, "from-chart") || strings.Count(dep, "AWS_PROFILE") != 1 {
+		t.Errorf("chart AWS_PROFILE not replaced:\n%s", dep)
+	}
+}
+
+func parseObj(t *testing.T, doc string) classify.Obj {
+	t.Helper()
+	o, err := classify.Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
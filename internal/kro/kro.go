@@ -1,8 +1,12 @@
 package kro
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
+	"log"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -12,6 +16,7 @@ import (
 	"github.com/jayadeyemi/ack-kro-gen/internal/config"
 	"github.com/jayadeyemi/ack-kro-gen/internal/placeholders"
 	"github.com/jayadeyemi/ack-kro-gen/internal/render"
+	"github.com/jayadeyemi/ack-kro-gen/internal/transform"
 	"github.com/jayadeyemi/ack-kro-gen/internal/util"
 	"gopkg.in/yaml.v3"
 )
@@ -47,117 +52,345 @@ type SchemaSpec struct {
 }
 
 type Resource struct {
-	ID       string         `yaml:"id"`
-	Template map[string]any `yaml:"template"`
+	ID       string     `yaml:"id"`
+	Template *yaml.Node `yaml:"template"`
+	// IncludeWhen lists schema conditions that must all hold for KRO to create
+	// the resource.
+	IncludeWhen []string `yaml:"includeWhen,omitempty"`
 }
 
-// EmitRGDs orchestrates parse → classify → build → write.
-func EmitRGDs(gs config.GraphSpec, r *render.Result, outDir string) ([]string, error) {
-	absOutDir, err := filepath.Abs(outDir)
-	if err != nil {
-		return nil, fmt.Errorf("resolve output dir: %w", err)
+// templateNode encodes a template built in code into a node.
+func templateNode(v any) (*yaml.Node, error) {
+	var n yaml.Node
+	if err := n.Encode(v); err != nil {
+		return nil, fmt.Errorf("encode template: %w", err)
 	}
-	serviceUpper := toUpperService(gs.Service)
+	return &n, nil
+}
 
+// Objects parses the CRDs and rendered templates of r, in file order. Objects
+// rendered from templates/tests/ are marked as test hooks.
+func Objects(r *render.Result) ([]classify.Obj, error) {
 	var objs []classify.Obj
-	for _, crd := range r.CRDs {
-
-		o, err := classify.Parse(crd)
-		if err != nil {
-			return nil, fmt.Errorf("parse CRD: %w", err)
+	for _, name := range render.SortedKeys(r.CRDs) {
+		for _, doc := range util.SplitDocs(r.CRDs[name]) {
+			o, err := classify.ParseDoc(name, doc)
+			if err != nil {
+				return nil, fmt.Errorf("parse CRD: %w", err)
+			}
+			objs = append(objs, o)
 		}
-		objs = append(objs, o)
 	}
-	for _, body := range r.RenderedFiles {
-		for _, doc := range util.SplitYAML(body) {
-			if strings.TrimSpace(doc) == "" {
-				continue
-			}
-
-			o, err := classify.Parse(doc)
+	for _, name := range render.SortedKeys(r.RenderedFiles) {
+		for _, doc := range util.SplitDocs(r.RenderedFiles[name]) {
+			o, err := classify.ParseDoc(name, doc)
 			if err != nil {
 				return nil, fmt.Errorf("parse manifest: %w", err)
 			}
+			// Helm treats everything under templates/tests/ as a test hook.
+			if strings.Contains(name, "/templates/tests/") && !hasHook(o, testHook) {
+				o.Hooks = append(o.Hooks, testHook)
+			}
 			objs = append(objs, o)
 		}
 	}
+	return objs, nil
+}
 
-	groups := classify.Classify(objs)
+// ReadObjects returns the resource templates of the RGD written at path, in
+// resource order, and the includeWhen conditions of those that have any, keyed
+// by template node. Templates keep their ${...} expressions.
+func ReadObjects(path string) ([]classify.Obj, map[*yaml.Node][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) == 1 {
+		doc = *doc.Content[0]
+	}
+	resources := util.MappingValue(util.MappingValue(&doc, "spec"), "resources")
+	if resources == nil {
+		return nil, nil, fmt.Errorf("%s: not a ResourceGraphDefinition", path)
+	}
+	var objs []classify.Obj
+	when := map[*yaml.Node][]string{}
+	for i, item := range resources.Content {
+		t := util.MappingValue(item, "template")
+		if t == nil {
+			continue
+		}
+		o, err := classify.FromNode(t)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: resource %s: %w", path, scalarValue(util.MappingValue(item, "id")), err)
+		}
+		o.Source = classify.Source{File: path, Index: i, Line: t.Line}
+		for _, c := range items(util.MappingValue(item, "includeWhen")) {
+			when[o.Node] = append(when[o.Node], c.Value)
+		}
+		objs = append(objs, o)
+	}
+	return objs, when, nil
+}
+
+// EmitRGDs orchestrates parse → classify → build → write. It returns ctx.Err()
+// if ctx is done before a step starts.
+func EmitRGDs(ctx context.Context, gs config.GraphSpec, r *render.Result, outDir string) ([]string, error) {
+	absOutDir, err := filepath.Abs(outDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve output dir: %w", err)
+	}
+	serviceUpper := toUpperService(gs.Service)
+
+	objs, err := Objects(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	objs, dups, err := classify.Dedupe(objs)
+	if err != nil {
+		return nil, fmt.Errorf("duplicate objects: %w", err)
+	}
+	for _, d := range dups {
+		log.Printf("[%s] dedupe: merged identical copies: %s", gs.Service, d)
+	}
+	objs, hooks, err := planHooks(gs.Service, gs.Hooks.Policy, objs)
+	if err != nil {
+		return nil, err
+	}
+	groups := classifyRules(gs.Classification).Classify(objs)
 
 	// Build per-domain resources.
-	crdResources, err := buildCRDResources(groups.CRDs)
+	crdResources, err := buildCRDResources(gs.Service, groups.CRDs, gs.CRDs)
+	if err != nil {
+		return nil, err
+	}
+	ctrlObjs := append(append(append(append(hooks.Pre, groups.Core...), groups.RBAC...), groups.Workloads...), groups.Others...)
+	ctrlObjs = append(ctrlObjs, hooks.Post...)
+
+	// Apply the graph's post-render patches and plugins to the controller objects.
+	transformers, err := transform.FromConfig(gs.Transformers)
 	if err != nil {
 		return nil, err
 	}
-	ctrlResources, err := buildControllerResources(append(append(append(groups.Core, groups.RBAC...), groups.Deployments...), groups.Others...))
+	// Separated hooks go through the same pass, so a target may match either.
+	all, err := transform.Apply(ctx, gs.Service, transformers, append(ctrlObjs, hooks.Separate...))
 	if err != nil {
 		return nil, err
 	}
+	ctrlObjs, hooks.Separate = splitSeparated(all, hooks.Separate)
+	extra, err := authResources(gs, ctrlObjs)
+	if err != nil {
+		return nil, err
+	}
+	carm, err := carmResource()
+	if err != nil {
+		return nil, err
+	}
+	extra = append(extra, carm)
+	// Variants selected by the schema, with their includeWhen conditions.
+	when := map[*yaml.Node][]string{}
+	if gs.AWS.Auth.Mode == config.AuthModeSecret {
+		var mounted map[*yaml.Node][]string
+		if ctrlObjs, mounted, err = mountCredentials(gs, ctrlObjs); err != nil {
+			return nil, err
+		}
+		for n, c := range mounted {
+			when[n] = c
+		}
+	}
+	if gs.RBAC.NamespaceScope {
+		var scopes map[*yaml.Node][]string
+		if ctrlObjs, scopes, err = scopeVariants(gs.Service, ctrlObjs); err != nil {
+			return nil, err
+		}
+		for n, c := range scopes {
+			when[n] = c
+		}
+	}
+	ctrlResources, links := buildControllerResources(ctrlObjs)
+	for i, r := range ctrlResources {
+		ctrlResources[i].IncludeWhen = when[r.Template]
+	}
+	ctrlResources = append(extra, ctrlResources...)
+	log.Printf("[%s] refs: linked %d references between %d resources", gs.Service, links, len(ctrlResources))
+	var hookResources []Resource
+	if len(hooks.Separate) > 0 {
+		hookResources, _ = buildControllerResources(hooks.Separate)
+	}
 
 	// Build per-domain RGDs.
 	crdsRGD := MakeCRDsRGD(gs, serviceUpper, crdResources)
-	ctrlRGD := MakeCtrlRGD(gs, serviceUpper, ctrlResources)
+	ctrlRGD, err := MakeCtrlRGD(gs, serviceUpper, ctrlResources)
+	if err != nil {
+		return nil, err
+	}
 
 	// Write files.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	outAckDir := filepath.Join(absOutDir, "ack")
 	if err := os.MkdirAll(outAckDir, 0o755); err != nil {
 		return nil, err
 	}
 	crdsPath := filepath.Join(outAckDir, fmt.Sprintf("%s-crds.yaml", gs.Service))
 	ctrlPath := filepath.Join(outAckDir, fmt.Sprintf("%s-ctrl.yaml", gs.Service))
+	hooksPath := filepath.Join(outAckDir, fmt.Sprintf("%s-hooks.yaml", gs.Service))
 
-	for _, p := range []string{crdsPath, ctrlPath} {
+	for _, p := range []string{crdsPath, ctrlPath, hooksPath} {
 		absP, _ := filepath.Abs(p)
 		if !strings.HasPrefix(absP, absOutDir+string(filepath.Separator)) {
 			return nil, errors.New("refusing to write outside the output directory")
 		}
 	}
 
-	if err := writeYAML(crdsPath, crdsRGD); err != nil {
+	crdsSize, err := writeYAML(crdsPath, crdsRGD)
+	if err != nil {
+		return nil, err
+	}
+	warnSize(gs.Service, "crds", crdsPath, crdsSize, "crds.warnBytes", gs.CRDs.WarnBytes, "CRDs", func() sizes { return objSizes(groups.CRDs) })
+	ctrlSize, err := writeYAML(ctrlPath, ctrlRGD)
+	if err != nil {
 		return nil, err
 	}
-	if err := writeYAML(ctrlPath, ctrlRGD); err != nil {
+	warnSize(gs.Service, "ctrl", ctrlPath, ctrlSize, "rgd.warnBytes", gs.RGD.WarnBytes, "resources", func() sizes { return resourceSizes(ctrlResources) })
+	if hookResources == nil {
+		// Drop the hooks RGD left by an earlier run under the separate policy.
+		if err := os.Remove(hooksPath); err == nil {
+			log.Printf("[%s] hooks: removed stale %s", gs.Service, filepath.Base(hooksPath))
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return []string{crdsPath, ctrlPath}, nil
+	}
+	hooksSize, err := writeYAML(hooksPath, MakeHooksRGD(gs, serviceUpper, hookResources))
+	if err != nil {
 		return nil, err
 	}
-	return []string{crdsPath, ctrlPath}, nil
+	warnSize(gs.Service, "hooks", hooksPath, hooksSize, "rgd.warnBytes", gs.RGD.WarnBytes, "resources", func() sizes { return resourceSizes(hookResources) })
+	return []string{crdsPath, ctrlPath, hooksPath}, nil
 }
 
-func writeYAML(path string, v any) error {
-	b, err := marshalYAML(v)
-	if err != nil {
-		return err
+// warnSize logs a warning when the RGD written to path is larger than limit,
+// the value of setting, naming the largest entries. largest is only measured
+// when the warning is logged.
+func warnSize(service, stage, path string, size int64, setting string, limit int, what string, largest func() sizes) {
+	if limit > 0 && size > int64(limit) {
+		log.Printf("[%s] %s: warning: %s is %d bytes, over %s (%d); largest %s: %s", service, stage, filepath.Base(path), size, setting, limit, what, largest().top(3))
 	}
-	// run legacy scalar replacer now
-	out, err := placeholders.ReplaceYAMLScalars(string(b))
+}
+
+// classifyRules puts the graph's classification rules ahead of the defaults.
+// The CRD rule stays first, so no user rule can move CRDs out of the
+// <service>-crds RGD; the config schema rejects rules moving objects in.
+func classifyRules(specs []config.ClassifyRule) classify.Rules {
+	rules := make(classify.Rules, 0, len(specs)+len(classify.DefaultRules)+1)
+	rules = append(rules, classify.CRDRule)
+	for _, s := range specs {
+		rules = append(rules, classify.Rule{APIGroup: s.APIGroup, Kind: s.Kind, Name: s.Name, Group: s.Group, Weight: s.Weight})
+	}
+	return append(rules, classify.DefaultRules...)
+}
+
+// writeYAML encodes rgd to path in a single pass and returns the number of
+// bytes written. The resource templates are already nodes, so they are spliced
+// into the document instead of being re-encoded, and sentinels are replaced in
+// place on the final tree.
+func writeYAML(path string, rgd RGD) (int64, error) {
+	doc, err := rgdNode(rgd)
 	if err != nil {
-		return fmt.Errorf("placeholder replace: %w", err)
+		return 0, err
 	}
+	placeholders.ReplaceNodeScalars(doc)
 
-	return os.WriteFile(path, []byte(out), 0o644)
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	cw := &countingWriter{w: f}
+	w := bufio.NewWriter(cw)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	err = enc.Encode(doc)
+	if cerr := enc.Close(); err == nil {
+		err = cerr
+	}
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return cw.n, err
 }
 
-func marshalYAML(v any) ([]byte, error) {
-	var buf strings.Builder
-	enc := yaml.NewEncoder(&buf)
-	enc.SetIndent(2)
-	if err := enc.Encode(v); err != nil {
+// rgdNode builds the document node for rgd. Everything but the resource
+// templates is encoded normally; each template node is then set in place of
+// its placeholder, so the large CRD trees are never copied.
+func rgdNode(rgd RGD) (*yaml.Node, error) {
+	templates := make([]*yaml.Node, len(rgd.Spec.Resources))
+	bare := make([]Resource, len(rgd.Spec.Resources))
+	for i, r := range rgd.Spec.Resources {
+		templates[i] = r.Template
+		r.Template = nil
+		bare[i] = r
+	}
+	rgd.Spec.Resources = bare
+
+	var doc yaml.Node
+	if err := doc.Encode(rgd); err != nil {
 		return nil, err
 	}
-	_ = enc.Close()
-	return []byte(buf.String()), nil
+	items := util.MappingValue(util.MappingValue(&doc, "spec"), "resources")
+	if items == nil || len(items.Content) != len(templates) {
+		return nil, errors.New("encode RGD: resources not found")
+	}
+	for i, item := range items.Content {
+		t := templates[i]
+		if t == nil {
+			continue
+		}
+		if t.Kind == yaml.DocumentNode && len(t.Content) == 1 {
+			t = t.Content[0]
+		}
+		if idx := util.MappingIndex(item, "template"); idx >= 0 {
+			item.Content[idx+1] = t
+		}
+	}
+	return &doc, nil
 }
 
-var nonAlnum = regexp.MustCompile(`[^a-z0-9-]`)
+var nonAlnum = regexp.MustCompile(`[^A-Za-z0-9]+`)
 
+// makeID turns s into a lowerCamelCase resource ID, which KRO requires so the
+// ID can be used in ${<id>...} expressions: "ServiceAccount" becomes
+// serviceAccount and "s3-crds" becomes s3Crds.
 func makeID(s string) string {
-	s = strings.ToLower(s)
-	s = strings.ReplaceAll(s, " ", "-")
-	s = nonAlnum.ReplaceAllString(s, "-")
-	s = strings.Trim(s, "-")
-	if s == "" {
-		s = "res"
-	}
-	return s
+	var b strings.Builder
+	for _, part := range nonAlnum.Split(s, -1) {
+		if part == "" {
+			continue
+		}
+		if b.Len() == 0 {
+			part = strings.ToLower(part[:1]) + part[1:]
+		} else {
+			part = strings.ToUpper(part[:1]) + part[1:]
+		}
+		b.WriteString(part)
+	}
+	id := b.String()
+	if id == "" || id[0] < 'a' || id[0] > 'z' {
+		// IDs must start with a letter.
+		id = "res" + id
+	}
+	return id
 }
 
 func toUpperService(svc string) string {
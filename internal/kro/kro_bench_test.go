@@ -0,0 +1,49 @@
+package kro
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+	"github.com/jayadeyemi/ack-kro-gen/internal/render"
+)
+
+// fixtureResult returns the chart render checked in under testdata/<svc>:
+// crds.yaml holds the chart's CRDs and templates.yaml its rendered templates,
+// with placeholder sentinels in place of the schema references.
+func fixtureResult(tb testing.TB, svc string) *render.Result {
+	tb.Helper()
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join("testdata", svc, name))
+		if err != nil {
+			tb.Fatalf("fixture: %v", err)
+		}
+		return string(data)
+	}
+	return &render.Result{
+		CRDs:          map[string]string{svc + "-chart/crds/all.yaml": read("crds.yaml")},
+		RenderedFiles: map[string]string{svc + "-chart/templates/all.yaml": read("templates.yaml")},
+	}
+}
+
+func benchmarkEmit(b *testing.B, svc string) {
+	r := fixtureResult(b, svc)
+	gs := config.GraphSpec{Service: svc, Version: "0.0.0"}
+	out := b.TempDir()
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := EmitRGDs(context.Background(), gs, r, out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEmitRGDsEC2(b *testing.B) { benchmarkEmit(b, "ec2") }
+func BenchmarkEmitRGDsRDS(b *testing.B) { benchmarkEmit(b, "rds") }
@@ -0,0 +1,192 @@
+package kro
+
+import (
+	"fmt"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+	"github.com/jayadeyemi/ack-kro-gen/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+// ref is a reference from one rendered object to another by name. node is the
+// scalar holding the name, so it can be rewritten in place.
+type ref struct {
+	kind      string
+	namespace string
+	name      string
+	node      *yaml.Node
+}
+
+// clusterScoped lists the referenced kinds that have no namespace.
+var clusterScoped = map[string]bool{"ClusterRole": true, "Namespace": true}
+
+// podKinds maps workload kinds to the path of their pod spec.
+var podKinds = map[string][]string{
+	"Pod":         {"spec"},
+	"Deployment":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"ReplicaSet":  {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// findRefs returns the references o makes to other objects: role bindings'
+// roleRef and ServiceAccount subjects, pod service accounts, ConfigMaps and
+// Secrets used by volumes, env and image pulls, and webhook services.
+func findRefs(o classify.Obj) []ref {
+	var refs []ref
+	add := func(kind, namespace string, n *yaml.Node) {
+		if n == nil || n.Kind != yaml.ScalarNode || n.Value == "" {
+			return
+		}
+		if clusterScoped[kind] {
+			namespace = ""
+		}
+		refs = append(refs, ref{kind: kind, namespace: namespace, name: n.Value, node: n})
+	}
+	namespaceOr := func(n *yaml.Node) string {
+		if n != nil && n.Kind == yaml.ScalarNode && n.Value != "" {
+			return n.Value
+		}
+		return o.Namespace
+	}
+
+	switch o.Kind {
+	case "RoleBinding", "ClusterRoleBinding":
+		if rr := util.MappingValue(o.Node, "roleRef"); rr != nil {
+			add(scalarValue(util.MappingValue(rr, "kind")), o.Namespace, util.MappingValue(rr, "name"))
+		}
+		for _, s := range items(util.MappingValue(o.Node, "subjects")) {
+			if scalarValue(util.MappingValue(s, "kind")) == "ServiceAccount" {
+				add("ServiceAccount", namespaceOr(util.MappingValue(s, "namespace")), util.MappingValue(s, "name"))
+			}
+		}
+	case "MutatingWebhookConfiguration", "ValidatingWebhookConfiguration":
+		for _, w := range items(util.MappingValue(o.Node, "webhooks")) {
+			svc := util.MappingValue(util.MappingValue(w, "clientConfig"), "service")
+			add("Service", namespaceOr(util.MappingValue(svc, "namespace")), util.MappingValue(svc, "name"))
+		}
+	}
+
+	spec := podSpec(o)
+	if spec == nil {
+		return refs
+	}
+	sa := util.MappingValue(spec, "serviceAccountName")
+	if sa == nil {
+		sa = util.MappingValue(spec, "serviceAccount")
+	}
+	add("ServiceAccount", o.Namespace, sa)
+	for _, s := range items(util.MappingValue(spec, "imagePullSecrets")) {
+		add("Secret", o.Namespace, util.MappingValue(s, "name"))
+	}
+	for _, v := range items(util.MappingValue(spec, "volumes")) {
+		add("ConfigMap", o.Namespace, util.MappingValue(util.MappingValue(v, "configMap"), "name"))
+		add("Secret", o.Namespace, util.MappingValue(util.MappingValue(v, "secret"), "secretName"))
+		for _, src := range items(util.MappingValue(util.MappingValue(v, "projected"), "sources")) {
+			add("ConfigMap", o.Namespace, util.MappingValue(util.MappingValue(src, "configMap"), "name"))
+			add("Secret", o.Namespace, util.MappingValue(util.MappingValue(src, "secret"), "name"))
+		}
+	}
+	for _, c := range append(items(util.MappingValue(spec, "initContainers")), items(util.MappingValue(spec, "containers"))...) {
+		for _, e := range items(util.MappingValue(c, "envFrom")) {
+			add("ConfigMap", o.Namespace, util.MappingValue(util.MappingValue(e, "configMapRef"), "name"))
+			add("Secret", o.Namespace, util.MappingValue(util.MappingValue(e, "secretRef"), "name"))
+		}
+		for _, e := range items(util.MappingValue(c, "env")) {
+			from := util.MappingValue(e, "valueFrom")
+			add("ConfigMap", o.Namespace, util.MappingValue(util.MappingValue(from, "configMapKeyRef"), "name"))
+			add("Secret", o.Namespace, util.MappingValue(util.MappingValue(from, "secretKeyRef"), "name"))
+		}
+	}
+	return refs
+}
+
+// podSpec returns the pod spec of a workload object, or nil.
+func podSpec(o classify.Obj) *yaml.Node {
+	path, ok := podKinds[o.Kind]
+	if !ok {
+		return nil
+	}
+	spec := o.Node
+	for _, key := range path {
+		spec = util.MappingValue(spec, key)
+	}
+	return spec
+}
+
+// linkResources rewrites every reference between res to
+// ${<id>.metadata.name}, so KRO sees the dependency, and returns res sorted
+// so each resource follows the ones it references, along with the number of
+// references rewritten. Resources keep their input order where no reference
+// constrains them. res[i] must be built from objs[i]. Only roles, service
+// accounts, ConfigMaps, Secrets and Services are referenced, and none of them
+// refers to anything, so the references cannot form a cycle.
+func linkResources(objs []classify.Obj, res []Resource) ([]Resource, int) {
+	key := func(kind, namespace, name string) string { return kind + "/" + namespace + "/" + name }
+	index := make(map[string]int, len(objs))
+	for i, o := range objs {
+		ns := o.Namespace
+		if clusterScoped[o.Kind] {
+			ns = ""
+		}
+		if _, dup := index[key(o.Kind, ns, o.Name)]; !dup {
+			index[key(o.Kind, ns, o.Name)] = i
+		}
+	}
+
+	deps := make([][]int, len(objs))
+	links := 0
+	for i, o := range objs {
+		for _, r := range findRefs(o) {
+			j, ok := index[key(r.kind, r.namespace, r.name)]
+			if !ok && r.namespace != "" {
+				// Charts often leave the namespace off and let the release set it.
+				j, ok = index[key(r.kind, "", r.name)]
+			}
+			if !ok || j == i {
+				continue
+			}
+			r.node.Value = fmt.Sprintf("${%s.metadata.name}", res[j].ID)
+			r.node.Style = 0
+			deps[i] = append(deps[i], j)
+			links++
+		}
+	}
+
+	// Depth-first in input order: each resource is preceded by the resources
+	// it references, pulled forward only as far as needed.
+	out := make([]Resource, 0, len(res))
+	done := make([]bool, len(res))
+	var visit func(i int)
+	visit = func(i int) {
+		if done[i] {
+			return
+		}
+		done[i] = true
+		for _, j := range deps[i] {
+			visit(j)
+		}
+		out = append(out, res[i])
+	}
+	for i := range res {
+		visit(i)
+	}
+	return out, links
+}
+
+// items returns the entries of a sequence node, or nil.
+func items(n *yaml.Node) []*yaml.Node {
+	if n == nil || n.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return n.Content
+}
+
+func scalarValue(n *yaml.Node) string {
+	if n == nil || n.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return n.Value
+}
@@ -0,0 +1,73 @@
+package kro
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+)
+
+func TestBuildControllerResourcesLinksReferences(t *testing.T) {
+	var objs []classify.Obj
+	for _, d := range []string{
+		`apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata: {name: rb, namespace: __KRO_NAMESPACE__}
+roleRef: {apiGroup: rbac.authorization.k8s.io, kind: Role, name: __KRO_NAME__-role}
+subjects:
+  - {kind: ServiceAccount, name: _SA_NAME_, namespace: __KRO_NAMESPACE__}
+`,
+		`apiVersion: apps/v1
+kind: Deployment
+metadata: {name: d, namespace: __KRO_NAMESPACE__}
+spec:
+  template:
+    spec:
+      serviceAccountName: _SA_NAME_
+      volumes:
+        - name: cfg
+          configMap: {name: settings}
+        - name: other
+          configMap: {name: not-rendered}
+`,
+		"apiVersion: rbac.authorization.k8s.io/v1\nkind: Role\nmetadata: {name: __KRO_NAME__-role, namespace: __KRO_NAMESPACE__}\n",
+		"apiVersion: v1\nkind: ConfigMap\nmetadata: {name: settings, namespace: __KRO_NAMESPACE__}\n",
+		"apiVersion: v1\nkind: ServiceAccount\nmetadata: {name: _SA_NAME_}\n",
+	} {
+		o, err := classify.Parse(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		objs = append(objs, o)
+	}
+
+	res, links := buildControllerResources(objs)
+	var ids []string
+	for _, r := range res {
+		ids = append(ids, r.ID)
+	}
+	if got, want := strings.Join(ids, ","), "role,serviceAccount,roleBinding,configMap,deployment"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+	if links != 4 {
+		t.Errorf("links = %d, want 4", links)
+	}
+	rb, err := objs[0].YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep, err := objs[1].YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"name: ${role.metadata.name}", "name: ${serviceAccount.metadata.name}\n    namespace: __KRO_NAMESPACE__"} {
+		if !strings.Contains(rb, want) {
+			t.Errorf("role binding missing %q:\n%s", want, rb)
+		}
+	}
+	for _, want := range []string{"serviceAccountName: ${serviceAccount.metadata.name}", "name: ${configMap.metadata.name}", "name: not-rendered"} {
+		if !strings.Contains(dep, want) {
+			t.Errorf("deployment missing %q:\n%s", want, dep)
+		}
+	}
+}
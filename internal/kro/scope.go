@@ -0,0 +1,230 @@
+package kro
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+	"github.com/jayadeyemi/ack-kro-gen/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+// includeWhen conditions selecting the RBAC variant for the schema's installScope.
+const (
+	clusterScope   = `${schema.spec.installScope == "cluster"}`
+	namespaceScope = `${schema.spec.installScope == "namespace"}`
+)
+
+// watchNamespace is where namespace-scoped Roles and RoleBindings are created:
+// the watched namespace, or the controller's own when none is set.
+const watchNamespace = `${schema.spec.watchNamespace != "" ? schema.spec.watchNamespace : schema.spec.namespace}`
+
+// clusterScopedSuffix names the ClusterRole and binding that keep a split
+// ClusterRole's cluster-level rules in the namespace-scoped variant.
+const clusterScopedSuffix = "-cluster-scoped"
+
+// clusterResources lists the RBAC resources that have no namespace, so a
+// Role cannot grant them.
+var clusterResources = map[string]bool{
+	"apiservices":                     true,
+	"certificatesigningrequests":      true,
+	"clusterrolebindings":             true,
+	"clusterroles":                    true,
+	"csidrivers":                      true,
+	"csinodes":                        true,
+	"customresourcedefinitions":       true,
+	"ingressclasses":                  true,
+	"mutatingwebhookconfigurations":   true,
+	"namespaces":                      true,
+	"nodes":                           true,
+	"persistentvolumes":               true,
+	"priorityclasses":                 true,
+	"runtimeclasses":                  true,
+	"storageclasses":                  true,
+	"validatingwebhookconfigurations": true,
+	"volumeattachments":               true,
+}
+
+// scopeVariants adds a namespace-scoped variant of the rendered cluster RBAC.
+// Each ClusterRole granting namespaced resources gets a Role in the watch
+// namespace with those rules, plus a ClusterRole with the remaining
+// cluster-level rules (namespaces, CRD reads) if there are any; its
+// ClusterRoleBindings get matching bindings. The original and derived objects
+// are returned with the includeWhen conditions that select them by the
+// schema's installScope, keyed by template node. ClusterRoles granting only
+// cluster-level resources are shared by both variants.
+func scopeVariants(service string, objs []classify.Obj) ([]classify.Obj, map[*yaml.Node][]string, error) {
+	type split struct{ namespaced, cluster []*yaml.Node }
+	splits := map[string]split{}
+	for _, o := range objs {
+		if o.Kind != "ClusterRole" || util.MappingValue(o.Node, "aggregationRule") != nil {
+			continue
+		}
+		var s split
+		for _, r := range items(util.MappingValue(o.Node, "rules")) {
+			ns, cl := splitRule(r)
+			if ns != nil {
+				s.namespaced = append(s.namespaced, ns)
+			}
+			if cl != nil {
+				s.cluster = append(s.cluster, cl)
+			}
+		}
+		if len(s.namespaced) > 0 {
+			splits[o.Name] = s
+		}
+	}
+
+	when := map[*yaml.Node][]string{}
+	out := make([]classify.Obj, 0, len(objs))
+	add := func(o classify.Obj, cond string) {
+		when[o.Node] = []string{cond}
+		out = append(out, o)
+	}
+	for _, o := range objs {
+		switch o.Kind {
+		case "ClusterRole":
+			s, ok := splits[o.Name]
+			if !ok {
+				break
+			}
+			add(o, clusterScope)
+			role, err := derive(o, "Role", o.Name, watchNamespace, func(n *yaml.Node) {
+				setSequence(n, "rules", s.namespaced)
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			add(role, namespaceScope)
+			if len(s.cluster) > 0 {
+				cr, err := derive(o, "ClusterRole", o.Name+clusterScopedSuffix, "", func(n *yaml.Node) {
+					setSequence(n, "rules", s.cluster)
+				})
+				if err != nil {
+					return nil, nil, err
+				}
+				add(cr, namespaceScope)
+			}
+			log.Printf("[%s] rbac: ClusterRole/%s gets a namespace-scoped variant (%d namespaced, %d cluster rules)",
+				service, o.Name, len(s.namespaced), len(s.cluster))
+			continue
+		case "ClusterRoleBinding":
+			ref := util.MappingValue(o.Node, "roleRef")
+			s, ok := splits[scalarValue(util.MappingValue(ref, "name"))]
+			if !ok || scalarValue(util.MappingValue(ref, "kind")) != "ClusterRole" {
+				break
+			}
+			role := scalarValue(util.MappingValue(ref, "name"))
+			add(o, clusterScope)
+			rb, err := derive(o, "RoleBinding", o.Name, watchNamespace, func(n *yaml.Node) {
+				setScalar(util.MappingValue(n, "roleRef"), "kind", "Role")
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			add(rb, namespaceScope)
+			if len(s.cluster) > 0 {
+				crb, err := derive(o, "ClusterRoleBinding", o.Name+clusterScopedSuffix, "", func(n *yaml.Node) {
+					setScalar(util.MappingValue(n, "roleRef"), "name", role+clusterScopedSuffix)
+				})
+				if err != nil {
+					return nil, nil, err
+				}
+				add(crb, namespaceScope)
+			}
+			continue
+		}
+		out = append(out, o)
+	}
+	return out, when, nil
+}
+
+// splitRule splits a policy rule into the part granting namespaced resources
+// and the part granting cluster-level ones; either may be nil. Wildcard
+// resources stay namespaced rather than granting every cluster resource, and
+// the cluster part only keeps read verbs, so a namespace-scoped install cannot
+// change cluster-level objects.
+func splitRule(rule *yaml.Node) (namespaced, cluster *yaml.Node) {
+	if util.MappingValue(rule, "nonResourceURLs") != nil {
+		return nil, readOnly(rule)
+	}
+	var ns, cl []*yaml.Node
+	for _, r := range items(util.MappingValue(rule, "resources")) {
+		base, _, _ := strings.Cut(r.Value, "/")
+		if clusterResources[base] {
+			cl = append(cl, r)
+		} else {
+			ns = append(ns, r)
+		}
+	}
+	switch {
+	case len(cl) == 0:
+		return rule, nil
+	case len(ns) == 0:
+		return nil, readOnly(rule)
+	}
+	namespaced, cluster = util.CloneNode(rule), util.CloneNode(rule)
+	setSequence(namespaced, "resources", ns)
+	setSequence(cluster, "resources", cl)
+	return namespaced, readOnly(cluster)
+}
+
+// readVerbs are the verbs kept in cluster-level rules of the namespace-scoped
+// variant.
+var readVerbs = []string{"get", "list", "watch"}
+
+// readOnly returns a copy of rule granting only the read verbs it grants, or
+// nil if it grants none. A "*" verb grants all of them.
+func readOnly(rule *yaml.Node) *yaml.Node {
+	granted := map[string]bool{}
+	for _, v := range items(util.MappingValue(rule, "verbs")) {
+		granted[v.Value] = true
+	}
+	var verbs []*yaml.Node
+	for _, v := range readVerbs {
+		if granted[v] || granted["*"] {
+			verbs = append(verbs, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v})
+		}
+	}
+	if len(verbs) == 0 {
+		return nil
+	}
+	c := util.CloneNode(rule)
+	setSequence(c, "verbs", verbs)
+	return c
+}
+
+// derive copies o as kind/name in namespace (none if empty) and lets edit
+// change the copy before it is parsed.
+func derive(o classify.Obj, kind, name, namespace string, edit func(*yaml.Node)) (classify.Obj, error) {
+	n := util.CloneNode(o.Node)
+	setScalar(n, "kind", kind)
+	md := ensureMapping(n, "metadata")
+	setScalar(md, "name", name)
+	if namespace != "" {
+		setScalar(md, "namespace", namespace)
+	} else if i := util.MappingIndex(md, "namespace"); i >= 0 {
+		md.Content = append(md.Content[:i], md.Content[i+2:]...)
+	}
+	edit(n)
+	d, err := classify.FromNode(n)
+	if err != nil {
+		return classify.Obj{}, fmt.Errorf("derive %s/%s: %w", kind, name, err)
+	}
+	d.Source = o.Source
+	return d, nil
+}
+
+// setSequence sets key in mapping m to a sequence of copies of vals.
+func setSequence(m *yaml.Node, key string, vals []*yaml.Node) {
+	seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, v := range vals {
+		seq.Content = append(seq.Content, util.CloneNode(v))
+	}
+	if i := util.MappingIndex(m, key); i >= 0 {
+		m.Content[i+1] = seq
+		return
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, seq)
+}
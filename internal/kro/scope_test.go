@@ -0,0 +1,75 @@
+package kro
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+)
+
+func TestScopeVariants(t *testing.T) {
+	objs := []classify.Obj{
+		parseObj(t, `apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata: {name: ctrl}
+rules:
+  - apiGroups: [""]
+    resources: [configmaps, namespaces]
+    verbs: [get, list, create]
+  - apiGroups: [s3.services.k8s.aws]
+    resources: [buckets, buckets/status]
+    verbs: ["*"]
+`),
+		parseObj(t, "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata: {name: ns-cache}\nrules:\n  - apiGroups: [\"\"]\n    resources: [namespaces]\n    verbs: [get]\n"),
+		parseObj(t, "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRoleBinding\nmetadata: {name: ctrl}\nroleRef: {kind: ClusterRole, name: ctrl}\nsubjects: [{kind: ServiceAccount, name: sa, namespace: ns}]\n"),
+		parseObj(t, "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRoleBinding\nmetadata: {name: ns-cache}\nroleRef: {kind: ClusterRole, name: ns-cache}\n"),
+	}
+	out, when, err := scopeVariants("s3", objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, o := range out {
+		got = append(got, o.Kind+"/"+o.Name+strings.Join(when[o.Node], ""))
+	}
+	want := []string{
+		"ClusterRole/ctrl" + clusterScope,
+		"Role/ctrl" + namespaceScope,
+		"ClusterRole/ctrl-cluster-scoped" + namespaceScope,
+		"ClusterRole/ns-cache",
+		"ClusterRoleBinding/ctrl" + clusterScope,
+		"RoleBinding/ctrl" + namespaceScope,
+		"ClusterRoleBinding/ctrl-cluster-scoped" + namespaceScope,
+		"ClusterRoleBinding/ns-cache",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("objects:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	role, _ := out[1].YAML()
+	if strings.Contains(role, "namespaces") || !strings.Contains(role, "- configmaps") || !strings.Contains(role, "- buckets/status") {
+		t.Errorf("role rules:\n%s", role)
+	}
+	if out[1].Namespace != watchNamespace {
+		t.Errorf("role namespace = %s", out[1].Namespace)
+	}
+	cluster, _ := out[2].YAML()
+	if strings.Contains(cluster, "configmaps") || !strings.Contains(cluster, "- namespaces") {
+		t.Errorf("cluster-scoped rules:\n%s", cluster)
+	}
+	if strings.Contains(cluster, "create") || !strings.Contains(cluster, "- get\n") || !strings.Contains(role, "- create\n") {
+		t.Errorf("cluster-scoped rules keep write verbs:\n%s", cluster)
+	}
+	rb, _ := out[5].YAML()
+	if !strings.Contains(rb, "kind: Role\n") {
+		t.Errorf("role binding:\n%s", rb)
+	}
+	crb, _ := out[6].YAML()
+	if !strings.Contains(crb, "name: ctrl-cluster-scoped\n") || strings.Count(crb, "ctrl-cluster-scoped") != 2 {
+		t.Errorf("cluster-scoped binding:\n%s", crb)
+	}
+	if orig, _ := objs[0].YAML(); !strings.Contains(orig, "namespaces") {
+		t.Errorf("original ClusterRole changed:\n%s", orig)
+	}
+}
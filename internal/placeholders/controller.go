@@ -54,6 +54,39 @@ func ControllerValues(gs config.GraphSpec, overrides map[string]any) map[string]
 		roleFallback = fmt.Sprintf("IRSA role for ACK %s controller deployment on EKS cluster using KRO Resource Graph", strings.ToLower(serviceName))
 	}
 	setNestedValue(values, []string{"iamRole", "roleDescription"}, StringDefault("", roleFallback))
+	setNestedValue(values, []string{"iamRole", "oidcProvider"}, StringDefault(gs.IAMRole.OIDCProvider, schemaDefaultValue("iamRole.oidcProvider")))
+	// Instances may map accounts of their own, so carm.accounts is in every
+	// schema, empty when graphs.yaml has none.
+	accounts := gs.CARM.Accounts
+	if accounts == nil {
+		accounts = map[string]string{}
+	}
+	b, _ := json.Marshal(accounts)
+	setNestedValue(values, []string{"carm", "accounts"}, "object | default="+string(b))
+	switch gs.AWS.Auth.Mode {
+	case config.AuthModePodIdentity:
+		// The association cannot be created without a cluster, so instances
+		// must name one when graphs.yaml does not.
+		clusterName := `string | required=true`
+		if c := strings.TrimSpace(gs.AWS.Auth.ClusterName); c != "" {
+			clusterName = StringDefault(c, "")
+		}
+		setNestedValue(values, []string{"podIdentity", "clusterName"}, clusterName)
+	case config.AuthModeSecret:
+		// Without a secretName in graphs.yaml the graph creates the Secret itself.
+		secretName := gs.AWS.SecretName
+		if secretName == "" {
+			secretName = strings.TrimSpace(gs.ReleaseName)
+			if secretName == "" {
+				secretName = defaultControllerName(gs)
+			}
+			secretName += "-aws-credentials"
+		}
+		setNestedValue(values, []string{"aws", "credentials", "secretName"}, StringDefault(secretName, ""))
+		setNestedValue(values, []string{"aws", "credentials", "create"}, BoolDefault("", gs.AWS.SecretName == ""))
+		setNestedValue(values, []string{"aws", "credentials", "mount"}, BoolDefault("", true))
+		setNestedValue(values, []string{"aws", "credentials", "content"}, StringDefault("", ""))
+	}
 
 	if len(overrides) > 0 {
 		values["overrides"] = overrides
@@ -87,7 +120,7 @@ func DefaultRepo(serviceName string) string {
     return fmt.Sprintf("public.ecr.aws/aws-controllers-k8s/%s-controller", strings.ToLower(svc))
 }
 
-// DefaultTag returns an empty string; Image.Tag from GraphSpec is required and will be used.
+// DefaultTag returns an empty string; Image.Tag defaults to the chart appVersion before emit.
 func DefaultTag() string { return "" }
 
 func controllerDefaults(gs config.GraphSpec, chartDefaults map[string]any) (map[string]any, map[string]string) {
@@ -4,19 +4,37 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
+)
+
+var (
+	sentinelKeysOnce sync.Once
+	sentinelKeys     []string
 )
 
 // ApplySentinelToSchema replaces template sentinels with ${schema...} refs.
 func ApplySentinelToSchema(in string) string {
-	// Longest-key-first to avoid partial overlaps.
-	keys := make([]string, 0, len(SentinelToSchema))
-	for k := range SentinelToSchema {
-		keys = append(keys, k)
+	// Every sentinel is wrapped in underscores; most scalars have none.
+	if !strings.Contains(in, "_") {
+		return in
 	}
-	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	// Longest-key-first to avoid partial overlaps. The order is computed once,
+	// since this runs for every scalar of every emitted graph.
+	sentinelKeysOnce.Do(func() {
+		sentinelKeys = make([]string, 0, len(SentinelToSchema))
+		for k := range SentinelToSchema {
+			sentinelKeys = append(sentinelKeys, k)
+		}
+		sort.Slice(sentinelKeys, func(i, j int) bool {
+			if len(sentinelKeys[i]) != len(sentinelKeys[j]) {
+				return len(sentinelKeys[i]) > len(sentinelKeys[j])
+			}
+			return sentinelKeys[i] < sentinelKeys[j]
+		})
+	})
 
 	out := in
-	for _, k := range keys {
+	for _, k := range sentinelKeys {
 		out = strings.ReplaceAll(out, k, SentinelToSchema[k])
 	}
 	return out
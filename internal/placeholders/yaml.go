@@ -33,6 +33,10 @@ func ReplaceYAMLScalars(in string) (string, error) {
 	return buf.String(), nil
 }
 
+// ReplaceNodeScalars applies the sentinel → schema placeholder translation to
+// every scalar below n, in place.
+func ReplaceNodeScalars(n *yaml.Node) { applyScalarReplace(n) }
+
 func applyScalarReplace(n *yaml.Node) {
 	if n == nil {
 		return
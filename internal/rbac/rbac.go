@@ -0,0 +1,331 @@
+// Package rbac aggregates the Roles and ClusterRoles a chart renders into a
+// verb matrix per API group and resource, for review and for comparing chart
+// versions.
+package rbac
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+	"gopkg.in/yaml.v3"
+)
+
+// Scopes a rule can apply at: ClusterRole rules are cluster-wide, Role rules
+// are limited to the Role's namespace.
+const (
+	ScopeCluster   = "cluster"
+	ScopeNamespace = "namespace"
+)
+
+// NonResource is the API group non-resource URLs are listed under.
+const NonResource = "(non-resource)"
+
+// Verbs are the matrix columns, in display order. Any other verb is listed
+// under OTHER.
+var Verbs = []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection"}
+
+// escalationVerbs let the holder grant or assume permissions beyond its own.
+var escalationVerbs = map[string]bool{"escalate": true, "bind": true, "impersonate": true}
+
+// Key is one row of the matrix.
+type Key struct {
+	Scope    string
+	APIGroup string
+	Resource string
+}
+
+func (k Key) String() string {
+	group := k.APIGroup
+	if group == "" {
+		group = "core"
+	}
+	return fmt.Sprintf("%s %s/%s", k.Scope, group, k.Resource)
+}
+
+// Matrix maps each row to the sorted verbs granted on it by any role.
+type Matrix map[Key][]string
+
+type rule struct {
+	APIGroups       []string `yaml:"apiGroups"`
+	Resources       []string `yaml:"resources"`
+	NonResourceURLs []string `yaml:"nonResourceURLs"`
+	Verbs           []string `yaml:"verbs"`
+}
+
+// FromObjects aggregates the rules of every Role and ClusterRole in objs;
+// other objects are ignored. Resource names are not tracked, so a rule limited
+// to named objects counts for the whole resource.
+func FromObjects(objs []classify.Obj) (Matrix, error) {
+	m := Matrix{}
+	for _, o := range objs {
+		scope, ok := roleScope(o)
+		if !ok {
+			continue
+		}
+		var role struct {
+			Rules []rule `yaml:"rules"`
+		}
+		if err := o.Node.Decode(&role); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", o.Kind, o.Name, err)
+		}
+		for _, r := range role.Rules {
+			for _, g := range r.APIGroups {
+				for _, res := range r.Resources {
+					m.add(Key{Scope: scope, APIGroup: g, Resource: res}, r.Verbs)
+				}
+			}
+			for _, u := range r.NonResourceURLs {
+				m.add(Key{Scope: scope, APIGroup: NonResource, Resource: u}, r.Verbs)
+			}
+		}
+	}
+	return m, nil
+}
+
+// roleScope reports the scope of o's rules, and whether o is a Role or
+// ClusterRole at all.
+func roleScope(o classify.Obj) (string, bool) {
+	if !strings.HasPrefix(o.APIVersion, "rbac.authorization.k8s.io/") {
+		return "", false
+	}
+	switch o.Kind {
+	case "ClusterRole":
+		return ScopeCluster, true
+	case "Role":
+		return ScopeNamespace, true
+	}
+	return "", false
+}
+
+// Variant is the matrix of the roles an RGD creates when its includeWhen
+// conditions hold.
+type Variant struct {
+	When   []string
+	Matrix Matrix
+}
+
+// Variants aggregates objs once per distinct set of includeWhen conditions
+// on their roles, from when keyed by template node. Each variant counts the
+// roles without conditions and those with its own, in the order the sets
+// first appear; with no conditional roles there is one variant without
+// conditions.
+func Variants(objs []classify.Obj, when map[*yaml.Node][]string) ([]Variant, error) {
+	var shared []classify.Obj
+	var order []string
+	conds := map[string][]string{}
+	byCond := map[string][]classify.Obj{}
+	for _, o := range objs {
+		if _, ok := roleScope(o); !ok {
+			continue
+		}
+		c := when[o.Node]
+		if len(c) == 0 {
+			shared = append(shared, o)
+			continue
+		}
+		k := strings.Join(c, " && ")
+		if _, ok := conds[k]; !ok {
+			conds[k] = c
+			order = append(order, k)
+		}
+		byCond[k] = append(byCond[k], o)
+	}
+	if len(order) == 0 {
+		m, err := FromObjects(shared)
+		if err != nil {
+			return nil, err
+		}
+		return []Variant{{Matrix: m}}, nil
+	}
+	variants := make([]Variant, 0, len(order))
+	for _, k := range order {
+		m, err := FromObjects(append(append([]classify.Obj{}, shared...), byCond[k]...))
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, Variant{When: conds[k], Matrix: m})
+	}
+	return variants, nil
+}
+
+func (m Matrix) add(k Key, verbs []string) {
+	m[k] = union(m[k], verbs)
+}
+
+// Keys returns the rows of m sorted by scope, API group and resource.
+func (m Matrix) Keys() []Key {
+	keys := make([]Key, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sortKeys(keys)
+	return keys
+}
+
+// Flags names what a reviewer should look at in a row granting verbs:
+// "wildcard" for any "*", "secrets" for access to core Secrets and
+// "escalation" for the escalate, bind and impersonate verbs.
+func Flags(k Key, verbs []string) []string {
+	var flags []string
+	if k.APIGroup == "*" || k.Resource == "*" || has(verbs, "*") {
+		flags = append(flags, "wildcard")
+	}
+	if (k.APIGroup == "" || k.APIGroup == "*") && (k.Resource == "secrets" || k.Resource == "*") && len(verbs) > 0 {
+		flags = append(flags, "secrets")
+	}
+	for _, v := range verbs {
+		if escalationVerbs[v] || v == "*" {
+			flags = append(flags, "escalation")
+			break
+		}
+	}
+	return flags
+}
+
+// Write prints m as a table with one column per verb in Verbs. A wildcard
+// verb marks every column with "*".
+func Write(w io.Writer, m Matrix) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	head := []string{"SCOPE", "APIGROUP", "RESOURCE"}
+	for _, v := range Verbs {
+		head = append(head, strings.ToUpper(v))
+	}
+	fmt.Fprintln(tw, strings.Join(append(head, "OTHER", "FLAGS"), "\t"))
+	for _, k := range m.Keys() {
+		verbs := m[k]
+		row := []string{k.Scope, groupName(k.APIGroup), k.Resource}
+		for _, v := range Verbs {
+			switch {
+			case has(verbs, "*"):
+				row = append(row, "*")
+			case has(verbs, v):
+				row = append(row, "x")
+			default:
+				row = append(row, "-")
+			}
+		}
+		row = append(row, orDash(strings.Join(otherVerbs(verbs), ",")), orDash(strings.Join(Flags(k, verbs), ",")))
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// Change is a row whose verbs differ between two matrices.
+type Change struct {
+	Key     Key
+	Added   []string
+	Removed []string
+}
+
+// Diff lists the rows of before and after whose verbs differ, sorted like Keys.
+// Verbs a "*" on the other side covers count as unchanged, so replacing a
+// wildcard with explicit verbs, or explicit verbs with a wildcard, reports
+// only the wildcard.
+func Diff(before, after Matrix) []Change {
+	seen := map[Key]bool{}
+	var keys []Key
+	for _, m := range []Matrix{before, after} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sortKeys(keys)
+	var changes []Change
+	for _, k := range keys {
+		c := Change{Key: k, Added: minus(after[k], before[k]), Removed: minus(before[k], after[k])}
+		if len(c.Added) > 0 || len(c.Removed) > 0 {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// WriteDiff prints changes as a table. Flags are computed on the added verbs
+// only, so they point at newly granted access.
+func WriteDiff(w io.Writer, changes []Change) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SCOPE\tAPIGROUP\tRESOURCE\tADDED\tREMOVED\tFLAGS")
+	for _, c := range changes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Key.Scope, groupName(c.Key.APIGroup), c.Key.Resource,
+			orDash(strings.Join(c.Added, ",")), orDash(strings.Join(c.Removed, ",")), orDash(strings.Join(Flags(c.Key, c.Added), ",")))
+	}
+	return tw.Flush()
+}
+
+func sortKeys(keys []Key) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Scope != b.Scope {
+			return a.Scope < b.Scope
+		}
+		if a.APIGroup != b.APIGroup {
+			return a.APIGroup < b.APIGroup
+		}
+		return a.Resource < b.Resource
+	})
+}
+
+func groupName(g string) string {
+	if g == "" {
+		return "core"
+	}
+	return g
+}
+
+func otherVerbs(verbs []string) []string {
+	var out []string
+	for _, v := range verbs {
+		if v != "*" && !has(Verbs, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func union(a, b []string) []string {
+	out := append([]string{}, a...)
+	for _, v := range b {
+		if !has(out, v) {
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// minus returns the verbs of a not in b; a "*" in b covers them all.
+func minus(a, b []string) []string {
+	if has(b, "*") {
+		return nil
+	}
+	var out []string
+	for _, v := range a {
+		if !has(b, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func has(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
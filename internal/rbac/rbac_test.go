@@ -0,0 +1,130 @@
+package rbac
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+	"gopkg.in/yaml.v3"
+)
+
+func parseObjs(t *testing.T, docs ...string) []classify.Obj {
+	t.Helper()
+	objs := make([]classify.Obj, 0, len(docs))
+	for _, d := range docs {
+		o, err := classify.Parse(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		objs = append(objs, o)
+	}
+	return objs
+}
+
+func TestMatrixAndDiff(t *testing.T) {
+	before, err := FromObjects(parseObjs(t, `apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata: {name: ack-s3-controller}
+rules:
+  - apiGroups: [s3.services.k8s.aws]
+    resources: [buckets, buckets/status]
+    verbs: [get, list, watch, update]
+  - apiGroups: [""]
+    resources: [secrets]
+    verbs: [get]
+  - nonResourceURLs: [/metrics]
+    verbs: [get]
+`, `apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata: {name: leader-election}
+rules:
+  - apiGroups: [coordination.k8s.io]
+    resources: [leases]
+    verbs: [get, create]
+  - apiGroups: [coordination.k8s.io]
+    resources: [leases]
+    verbs: [update, get]
+`, "apiVersion: v1\nkind: ConfigMap\nmetadata: {name: ignored}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := before[Key{ScopeNamespace, "coordination.k8s.io", "leases"}]; !reflect.DeepEqual(got, []string{"create", "get", "update"}) {
+		t.Fatalf("leases verbs = %v", got)
+	}
+	if _, ok := before[Key{ScopeCluster, NonResource, "/metrics"}]; !ok || len(before) != 5 {
+		t.Fatalf("rows = %v", before.Keys())
+	}
+	if f := Flags(Key{ScopeCluster, "", "secrets"}, []string{"get"}); !reflect.DeepEqual(f, []string{"secrets"}) {
+		t.Fatalf("secrets flags = %v", f)
+	}
+
+	after, err := FromObjects(parseObjs(t, `apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata: {name: ack-s3-controller}
+rules:
+  - apiGroups: [s3.services.k8s.aws]
+    resources: [buckets]
+    verbs: ["*"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := Diff(before, after)
+	if len(changes) != 5 {
+		t.Fatalf("changes = %+v", changes)
+	}
+	c := changes[2]
+	if c.Key.Resource != "buckets" || !reflect.DeepEqual(c.Added, []string{"*"}) || len(c.Removed) != 0 {
+		t.Fatalf("buckets change = %+v", c)
+	}
+
+	// Verbs the wildcard covers are not reported as removed either way.
+	if c := Diff(after, before)[2]; !reflect.DeepEqual(c.Removed, []string{"*"}) || len(c.Added) != 0 {
+		t.Fatalf("reverse buckets change = %+v", c)
+	}
+
+	var b strings.Builder
+	if err := WriteDiff(&b, changes); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "wildcard,escalation") {
+		t.Fatalf("diff does not flag the new wildcard:\n%s", b.String())
+	}
+}
+
+func TestVariants(t *testing.T) {
+	objs := parseObjs(t,
+		"apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata: {name: ns-cache}\nrules:\n  - apiGroups: [\"\"]\n    resources: [namespaces]\n    verbs: [get]\n",
+		"apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata: {name: ctrl}\nrules:\n  - apiGroups: [\"\"]\n    resources: [configmaps]\n    verbs: [get]\n",
+		"apiVersion: rbac.authorization.k8s.io/v1\nkind: Role\nmetadata: {name: ctrl}\nrules:\n  - apiGroups: [\"\"]\n    resources: [configmaps]\n    verbs: [get]\n",
+		"apiVersion: apps/v1\nkind: Deployment\nmetadata: {name: ctrl}\n",
+	)
+	when := map[*yaml.Node][]string{
+		objs[1].Node: {"cluster"},
+		objs[2].Node: {"namespace"},
+		objs[3].Node: {"mounted"},
+	}
+	variants, err := Variants(objs, when)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variants) != 2 || variants[0].When[0] != "cluster" || variants[1].When[0] != "namespace" {
+		t.Fatalf("variants = %+v", variants)
+	}
+	for i, scope := range []string{ScopeCluster, ScopeNamespace} {
+		m := variants[i].Matrix
+		if _, ok := m[Key{ScopeCluster, "", "namespaces"}]; !ok || len(m) != 2 {
+			t.Errorf("%s variant rows = %v", scope, m.Keys())
+		}
+		if _, ok := m[Key{scope, "", "configmaps"}]; !ok {
+			t.Errorf("%s variant misses its configmaps row: %v", scope, m.Keys())
+		}
+	}
+
+	variants, err = Variants(objs[:1], nil)
+	if err != nil || len(variants) != 1 || variants[0].When != nil {
+		t.Fatalf("unconditional variants = %+v, %v", variants, err)
+	}
+}
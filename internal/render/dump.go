@@ -0,0 +1,47 @@
+package render
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SortedKeys returns the file paths of a RenderedFiles or CRDs map in order.
+func SortedKeys(files map[string]string) []string {
+	keys := make([]string, 0, len(files))
+	for k := range files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Dump writes every CRD and rendered template in r under dir, at its chart
+// path (e.g. dir/s3-chart/templates/deployment.yaml), and returns the paths
+// written. Files are written as rendered, before any parsing, so they can be
+// inspected when a later stage fails.
+func (r *Result) Dump(dir string) ([]string, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("dump rendered: %w", err)
+	}
+	var wrote []string
+	for _, files := range []map[string]string{r.CRDs, r.RenderedFiles} {
+		for _, name := range SortedKeys(files) {
+			p := filepath.Join(root, filepath.FromSlash(name))
+			if !strings.HasPrefix(p, root+string(filepath.Separator)) {
+				return nil, fmt.Errorf("dump rendered: refusing to write %s outside %s", name, dir)
+			}
+			if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+				return nil, fmt.Errorf("dump rendered: %w", err)
+			}
+			if err := os.WriteFile(p, []byte(files[name]), 0o644); err != nil {
+				return nil, fmt.Errorf("dump rendered: %w", err)
+			}
+			wrote = append(wrote, p)
+		}
+	}
+	return wrote, nil
+}
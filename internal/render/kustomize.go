@@ -0,0 +1,269 @@
+package render
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/util"
+)
+
+// KustomizedFile is the RenderedFiles and CRDs key holding the objects the
+// kustomization adds itself, which have no chart file of their own.
+const KustomizedFile = "kustomize/output.yaml"
+
+// renderedResource is the name the rendered manifests appear under inside the
+// kustomization directory. It is added to the front of the kustomization's resources.
+const renderedResource = "ack-kro-gen-rendered.yaml"
+
+// sourceAnnotation records, on each object fed to kustomize, the chart files
+// it was rendered from, so the output can be filed back under them. It is
+// removed from the output.
+const sourceAnnotation = "ack-kro-gen.io/rendered-from"
+
+// Kustomize runs the kustomization in dir over the objects in r and returns a
+// Result holding its output instead. The rendered CRDs and templates are fed in
+// as the first entry of the kustomization's resources, so its patches,
+// transformers and components apply to them. Each output object is returned
+// under the chart file it was rendered from, in CRDs or RenderedFiles by kind,
+// so later stages still see template paths; objects the kustomization adds
+// itself go under KustomizedFile. Nothing is written to dir.
+func Kustomize(dir string, r *Result) (*Result, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("kustomize %s: %w", dir, err)
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return nil, fmt.Errorf("kustomize %s: %w", dir, err)
+	}
+	disk := filesys.MakeFsOnDisk()
+	kfile := ""
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if p := filepath.Join(abs, name); disk.Exists(p) {
+			kfile = p
+			break
+		}
+	}
+	if kfile == "" {
+		return nil, fmt.Errorf("kustomize %s: no kustomization file", dir)
+	}
+	kbody, err := disk.ReadFile(kfile)
+	if err != nil {
+		return nil, fmt.Errorf("kustomize %s: %w", dir, err)
+	}
+	kbody, err = prependResource(kbody, renderedResource)
+	if err != nil {
+		return nil, fmt.Errorf("kustomize %s: %w", kfile, err)
+	}
+	rendered, err := joinDocs(r)
+	if err != nil {
+		return nil, fmt.Errorf("kustomize %s: %w", dir, err)
+	}
+
+	fs := overlayFS{FileSystem: disk, files: map[string][]byte{
+		kfile:                                kbody,
+		filepath.Join(abs, renderedResource): []byte(rendered),
+	}}
+	resMap, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fs, abs)
+	if err != nil {
+		return nil, fmt.Errorf("kustomize %s: %w", dir, err)
+	}
+
+	crds, rest := map[string][]string{}, map[string][]string{}
+	for _, res := range resMap.Resources() {
+		sources := []string{KustomizedFile}
+		ann := res.GetAnnotations()
+		if from, ok := ann[sourceAnnotation]; ok {
+			sources = strings.Split(from, ",")
+			delete(ann, sourceAnnotation)
+			if err := res.SetAnnotations(ann); err != nil {
+				return nil, fmt.Errorf("kustomize %s: %s: %w", dir, res.CurId(), err)
+			}
+		}
+		b, err := res.AsYAML()
+		if err != nil {
+			return nil, fmt.Errorf("kustomize %s: %s: %w", dir, res.CurId(), err)
+		}
+		files := rest
+		if res.GetKind() == "CustomResourceDefinition" {
+			files = crds
+		}
+		for _, f := range sources {
+			files[f] = append(files[f], strings.TrimSpace(string(b)))
+		}
+	}
+	out := &Result{RenderedFiles: map[string]string{}, CRDs: map[string]string{}, AppVersion: r.AppVersion}
+	for f, docs := range crds {
+		out.CRDs[f] = strings.Join(docs, "\n---\n") + "\n"
+	}
+	for f, docs := range rest {
+		out.RenderedFiles[f] = strings.Join(docs, "\n---\n") + "\n"
+	}
+	return out, nil
+}
+
+// joinDocs concatenates the CRDs and rendered templates of r, in stable order,
+// into one multi-document YAML stream, annotating each object with the file it
+// came from. Identical copies of an object rendered by several files are fed
+// in once, annotated with all of them, so kustomize does not reject the
+// repeated ID and Dedupe can still report them.
+func joinDocs(r *Result) (string, error) {
+	type entry struct {
+		node  *yaml.Node
+		text  string
+		files []string
+	}
+	var entries []*entry
+	seen := map[string]*entry{}
+	for _, files := range []map[string]string{r.CRDs, r.RenderedFiles} {
+		for _, name := range SortedKeys(files) {
+			for _, d := range util.SplitYAML(files[name]) {
+				text := strings.TrimSpace(d)
+				if text == "" {
+					continue
+				}
+				var doc yaml.Node
+				if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+					return "", fmt.Errorf("%s: %w", name, err)
+				}
+				if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+					continue
+				}
+				obj := doc.Content[0]
+				id := docID(obj)
+				if e, ok := seen[id]; ok && e.text == text {
+					e.files = append(e.files, name)
+					continue
+				}
+				e := &entry{node: obj, text: text, files: []string{name}}
+				seen[id] = e
+				entries = append(entries, e)
+			}
+		}
+	}
+	var b strings.Builder
+	for _, e := range entries {
+		setAnnotation(e.node, sourceAnnotation, strings.Join(e.files, ","))
+		out, err := yaml.Marshal(e.node)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString("---\n")
+		b.Write(out)
+	}
+	return b.String(), nil
+}
+
+// docID identifies an object by apiVersion, kind, namespace and name.
+func docID(obj *yaml.Node) string {
+	meta := util.MappingValue(obj, "metadata")
+	return strings.Join([]string{
+		scalarValue(util.MappingValue(obj, "apiVersion")), scalarValue(util.MappingValue(obj, "kind")),
+		scalarValue(util.MappingValue(meta, "namespace")), scalarValue(util.MappingValue(meta, "name")),
+	}, "/")
+}
+
+// setAnnotation sets metadata.annotations[key] on obj, creating the maps as needed.
+func setAnnotation(obj *yaml.Node, key, value string) {
+	meta := ensureMapping(obj, "metadata")
+	ann := ensureMapping(meta, "annotations")
+	if v := util.MappingValue(ann, key); v != nil {
+		v.Value = value
+		return
+	}
+	ann.Content = append(ann.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Value: value, Style: yaml.DoubleQuotedStyle})
+}
+
+func ensureMapping(m *yaml.Node, key string) *yaml.Node {
+	if v := util.MappingValue(m, key); v != nil && v.Kind == yaml.MappingNode {
+		return v
+	}
+	v := &yaml.Node{Kind: yaml.MappingNode}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = v
+			return v
+		}
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, v)
+	return v
+}
+
+func scalarValue(n *yaml.Node) string {
+	if n == nil || n.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return n.Value
+}
+
+// prependResource returns the kustomization body with name added to the front of resources.
+func prependResource(body []byte, name string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode}}
+	}
+	m := doc.Content[0]
+	if m.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("kustomization is not a mapping")
+	}
+	entry := &yaml.Node{Kind: yaml.ScalarNode, Value: name}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == "resources" {
+			seq := m.Content[i+1]
+			if seq.Kind != yaml.SequenceNode {
+				seq.Kind, seq.Tag, seq.Value = yaml.SequenceNode, "!!seq", ""
+			}
+			seq.Content = append([]*yaml.Node{entry}, seq.Content...)
+			return yaml.Marshal(&doc)
+		}
+	}
+	m.Content = append(m.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: "resources"},
+		&yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{entry}})
+	return yaml.Marshal(&doc)
+}
+
+// overlayFS serves a few in-memory files over the real file system, so a
+// kustomization on disk can be run with generated inputs without touching it.
+type overlayFS struct {
+	filesys.FileSystem
+	files map[string][]byte
+}
+
+func (o overlayFS) ReadFile(path string) ([]byte, error) {
+	if b, ok := o.files[path]; ok {
+		return b, nil
+	}
+	return o.FileSystem.ReadFile(path)
+}
+
+func (o overlayFS) Exists(path string) bool {
+	if _, ok := o.files[path]; ok {
+		return true
+	}
+	return o.FileSystem.Exists(path)
+}
+
+func (o overlayFS) IsDir(path string) bool {
+	if _, ok := o.files[path]; ok {
+		return false
+	}
+	return o.FileSystem.IsDir(path)
+}
+
+func (o overlayFS) CleanedAbs(path string) (filesys.ConfirmedDir, string, error) {
+	if _, ok := o.files[path]; ok {
+		return filesys.ConfirmedDir(filepath.Dir(path)), filepath.Base(path), nil
+	}
+	return o.FileSystem.CleanedAbs(path)
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/jayadeyemi/ack-kro-gen/internal/util"
 
 	// "gopkg.in/yaml.v3" // not needed here
+	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/engine"
@@ -33,21 +34,49 @@ type Result struct {
 	// RenderedFiles holds rendered YAML from templates/. Each value may be a multi-document YAML string.
 	// Key is the normalized template path (using forward slashes).
 	RenderedFiles map[string]string
-	// CRDs contains raw YAML documents from crds/ files. No templating is applied.
-	CRDs []string
+	// CRDs holds raw YAML from crds/ files, keyed by file path like RenderedFiles. No templating is applied.
+	CRDs map[string]string
+	// AppVersion is the chart's appVersion, used as the default image tag.
+	AppVersion string
 }
 
 // RenderChart loads a Helm chart archive (or directory), renders templates with values derived from
 // the provided GraphSpec, and splits outputs into CRDs and controller manifests.
 func RenderChart(ctx context.Context, chartArchivePath string, gs config.GraphSpec) (*Result, error) {
-	// Load the chart from a .tgz path or directory. No network access here.
-	ch, err := loader.Load(chartArchivePath)
+	ch, err := LoadChart(ctx, chartArchivePath)
+	if err != nil {
+		return nil, err
+	}
+	return Render(ctx, ch, gs)
+}
+
+// LoadChart loads a Helm chart archive (or directory). No network access here.
+// It returns ctx.Err() if ctx is done before loading finishes.
+func LoadChart(ctx context.Context, chartArchivePath string) (*chart.Chart, error) {
+	var ch *chart.Chart
+	err := util.Await(ctx, func() error {
+		var err error
+		ch, err = loader.Load(chartArchivePath)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("load chart: %w", err)
 	}
+	return ch, nil
+}
+
+// Render renders a loaded chart with values derived from the provided GraphSpec and splits
+// outputs into CRDs and controller manifests. The context is checked between steps and
+// while the template engine runs.
+func Render(ctx context.Context, ch *chart.Chart, gs config.GraphSpec) (*Result, error) {
+	// Fields left empty in graphs.yaml fall back to chart metadata (image tag → appVersion).
+	gs.ApplyChartDefaults(ch.Metadata.AppVersion)
 
 	// Build the values map to feed into Helm's renderer based on GraphSpec.
-	vals := buildValues(gs)
+	vals, _, err := buildValues(gs)
+	if err != nil {
+		return nil, err
+	}
 
 	// Emulate a Helm release for templating. These can be used by templates as .Release.*.
 	rel := chartutil.ReleaseOptions{
@@ -58,8 +87,15 @@ func RenderChart(ctx context.Context, chartArchivePath string, gs config.GraphSp
 	}
 
 	// Capabilities influence templates that gate on Kubernetes version or APIs.
-	caps := chartutil.DefaultCapabilities
-	caps.KubeVersion.Version = "v1.27.0"
+	caps, err := capabilities(gs)
+	if err != nil {
+		return nil, err
+	}
+	// Charts may declare the Kubernetes versions they support; refuse to render for any other.
+	if c := ch.Metadata.KubeVersion; c != "" && !chartutil.IsCompatibleRange(c, caps.KubeVersion.String()) {
+		return nil, fmt.Errorf("chart %s-%s requires kubeVersion %q, which %s does not satisfy; set kubeVersion in graphs.yaml",
+			ch.Metadata.Name, ch.Metadata.Version, c, caps.KubeVersion.String())
+	}
 
 	// Merge chart defaults, user values, release, and capabilities into a render-ready structure.
 	rvals, err := chartutil.ToRenderValues(ch, vals, rel, caps)
@@ -69,16 +105,21 @@ func RenderChart(ctx context.Context, chartArchivePath string, gs config.GraphSp
 
 	// Render all templates from templates/ across root chart and subcharts.
 	// Returns a map[path]renderedText for every template file, regardless of extension.
-	renderer := engine.Engine{}
-	files, err := renderer.Render(ch, rvals.AsMap())
+	var files map[string]string
+	err = util.Await(ctx, func() error {
+		renderer := engine.Engine{}
+		var err error
+		files, err = renderer.Render(ch, rvals.AsMap())
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("engine render: %w", err)
 	}
 
 	// Collect CRDs from crds/ directories. These are emitted verbatim and not templated by Helm.
-	var crds []string
+	crds := map[string]string{}
 	for _, obj := range ch.CRDObjects() {
-		crds = append(crds, string(obj.File.Data))
+		crds[filepath.ToSlash(obj.Filename)] = string(obj.File.Data)
 	}
 
 	// Keep only YAML artifacts from the rendered templates. Drop non-YAML files (helpers, txt, etc).
@@ -106,148 +147,43 @@ func RenderChart(ctx context.Context, chartArchivePath string, gs config.GraphSp
 	}
 
 	// Return controller manifests (ordered) and raw CRDs.
-	return &Result{RenderedFiles: ordered, CRDs: crds}, nil
-}
-
-// buildValues constructs the Helm values map from GraphSpec, then merges in optional overrides.
-// Precedence (highest to lower within Extras.Values):
-//  1. <service>-chart (e.g., "s3-chart")
-//  2. "ack-chart" (shared defaults across ACK controllers)
-//  3. any other top-level keys, merged into the base under their own key
-//
-// Base seeds image, serviceAccount, log flags, and AWS region.
-func buildValues(gs config.GraphSpec) map[string]any {
-	// Base values seeded from GraphSpec.
-	base := map[string]any{
-		"image": map[string]any{
-			"repository": gs.Image.Repository,
-			"tag":        gs.Image.Tag,
-		},
-		"serviceAccount": map[string]any{
-			"name":        gs.ServiceAccount.Name, // string name
-			"annotations": map[string]any{},       // coerced to map[string]any below if needed
-		},
-		"logLevel": gs.Controller.LogLevel,
-		"logDev":   gs.Controller.LogDev,
-		"aws": map[string]any{
-			"region": gs.AWS.Region,
-		},
-	}
-
-	// If annotations are provided in GraphSpec, copy them into the base map.
-	if len(gs.ServiceAccount.Annotations) > 0 {
-		ann := make(map[string]any, len(gs.ServiceAccount.Annotations))
-		for k, v := range gs.ServiceAccount.Annotations {
-			ann[k] = v
-		}
-		base["serviceAccount"].(map[string]any)["annotations"] = ann
+	res := &Result{RenderedFiles: ordered, CRDs: crds, AppVersion: ch.Metadata.AppVersion}
+	if gs.Kustomize == "" {
+		return res, nil
 	}
 
-	// Merge user-provided values by precedence.
-	if gs.Extras.Values != nil {
-		svcKey := gs.Service + "-chart"
-
-		// 1) Service-specific overlay wins first.
-		if v, ok := gs.Extras.Values[svcKey]; ok {
-			if mv, ok := v.(map[string]any); ok {
-				deepMerge(base, mv)
-			}
-		}
-		// 2) Shared "ack-chart" overlay wins next.
-		if v, ok := gs.Extras.Values["ack-chart"]; ok {
-			if mv, ok := v.(map[string]any); ok {
-				deepMerge(base, mv)
-			}
-		}
-		// 3) Remaining keys are merged into or assigned at their respective top-level keys.
-		for k, v := range gs.Extras.Values {
-			if k == svcKey || k == "ack-chart" {
-				continue
-			}
-			if mv, ok := v.(map[string]any); ok {
-				// If base already has a map for this key, merge into it. Otherwise clone mv into base.
-				if cur, ok := base[k].(map[string]any); ok {
-					deepMerge(cur, mv)
-					base[k] = cur
-				} else {
-					base[k] = cloneMap(mv)
-				}
-			} else {
-				// Scalars overwrite directly.
-				base[k] = v
-			}
-		}
-	}
-
-	// Normalize serviceAccount type:
-	// If a chart expects serviceAccount to be a map, but a string name is supplied,
-	// convert the string form into a structured map with create:false and empty annotations.
-	if name, ok := base["serviceAccount"].(string); ok {
-		base["serviceAccount"] = map[string]any{
-			"create":      false,
-			"name":        name,
-			"annotations": map[string]any{},
-		}
-	}
-
-	// Ensure serviceAccount is a map and annotations is map[string]any.
-	sa, ok := base["serviceAccount"].(map[string]any)
-	if !ok {
-		sa = map[string]any{"name": gs.ServiceAccount.Name}
-	}
-	base["serviceAccount"] = sa
-
-	switch a := sa["annotations"].(type) {
-	case map[string]any:
-		// already correct
-	case map[string]string:
-		// copy into map[string]any for consistent types in templates.
-		m := make(map[string]any, len(a))
-		for k, v := range a {
-			m[k] = v
-		}
-		sa["annotations"] = m
-	default:
-		// ensure non-nil map
-		sa["annotations"] = map[string]any{}
+	// A kustomization replaces the rendered objects with its own output.
+	err = util.Await(ctx, func() error {
+		var err error
+		res, err = Kustomize(gs.Kustomize, res)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-
-	return base
+	return res, nil
 }
 
-// deepMerge recursively merges src into dst. For map values, it recurses. For scalars, src overwrites dst.
-// Assumes both dst and src are map[string]any.
-func deepMerge(dst, src map[string]any) {
-	for k, v := range src {
-		if vmap, ok := v.(map[string]any); ok {
-			// src value is a map
-			if dmap, ok := dst[k].(map[string]any); ok {
-				// both are maps → recurse
-				deepMerge(dmap, vmap)
-				dst[k] = dmap
-			} else {
-				// dst is missing or not a map → clone src map to avoid aliasing
-				dst[k] = cloneMap(vmap)
-			}
-		} else {
-			// scalar or non-map → overwrite
-			dst[k] = v
-		}
-	}
-}
+// DefaultKubeVersion is the Kubernetes version charts render against when a graph sets none.
+const DefaultKubeVersion = "v1.27.0"
 
-// cloneMap produces a deep copy of a map[string]any, cloning nested maps recursively.
-// Used to avoid sharing references during merges.
-func cloneMap(m map[string]any) map[string]any {
-	out := make(map[string]any, len(m))
-	for k, v := range m {
-		if mv, ok := v.(map[string]any); ok {
-			out[k] = cloneMap(mv)
-		} else {
-			out[k] = v
-		}
+// capabilities builds the render capabilities for gs from a copy of Helm's defaults,
+// so concurrent renders with different settings do not share state.
+func capabilities(gs config.GraphSpec) (*chartutil.Capabilities, error) {
+	caps := chartutil.DefaultCapabilities.Copy()
+	version := gs.KubeVersion
+	if version == "" {
+		version = DefaultKubeVersion
+	}
+	kv, err := chartutil.ParseKubeVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("kubeVersion %q: %w", version, err)
 	}
-	return out
+	caps.KubeVersion = *kv
+	// Copy shares the APIVersions backing array; clone it before appending.
+	apis := make(chartutil.VersionSet, 0, len(caps.APIVersions)+len(gs.APIVersions))
+	caps.APIVersions = append(append(apis, caps.APIVersions...), gs.APIVersions...)
+	return caps, nil
 }
 
 // SplitYAML is re-exported for tests and callers that need to split multi-doc YAML strings.
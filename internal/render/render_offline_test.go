@@ -2,6 +2,9 @@ package render
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/jayadeyemi/ack-kro-gen/internal/config"
@@ -9,7 +12,7 @@ import (
 
 func TestRenderDummyChart(t *testing.T) {
 	ctx := context.Background()
-	res, err := RenderChart(ctx, "internal/render/testdata/dummychart", config.GraphSpec{
+	res, err := RenderChart(ctx, "testdata/dummychart", config.GraphSpec{
 		Service:     "dummy",
 		Version:     "0.1.0",
 		ReleaseName: "__KRO_NAME__",
@@ -35,3 +38,101 @@ func TestRenderDummyChart(t *testing.T) {
 		t.Fatal("no rendered files")
 	}
 }
+
+func writeChart(t *testing.T, chartYAML, tmpl string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "templates"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte(chartYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "templates", "pdb.yaml"), []byte(tmpl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRenderCapabilities(t *testing.T) {
+	chart := writeChart(t, "apiVersion: v2\nname: caps\nversion: 0.1.0\nkubeVersion: \">=1.25.0-0\"\n", `apiVersion: {{ if .Capabilities.APIVersions.Has "example.com/v1" }}example.com/v1{{ else }}policy/v1{{ end }}
+kind: PodDisruptionBudget
+metadata:
+  name: {{ .Capabilities.KubeVersion.Version }}
+`)
+	ctx := context.Background()
+
+	res, err := RenderChart(ctx, chart, config.GraphSpec{Service: "caps", KubeVersion: "v1.29.3", APIVersions: []string{"example.com/v1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := res.RenderedFiles["caps/templates/pdb.yaml"]
+	if !strings.Contains(body, "example.com/v1") || !strings.Contains(body, "name: v1.29.3") {
+		t.Fatalf("capabilities not applied:\n%s", body)
+	}
+
+	_, err = RenderChart(ctx, chart, config.GraphSpec{Service: "caps", KubeVersion: "v1.24.0"})
+	if err == nil || !strings.Contains(err.Error(), `requires kubeVersion ">=1.25.0-0"`) {
+		t.Fatalf("expected kubeVersion constraint error, got %v", err)
+	}
+}
+
+func TestRenderKustomize(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"kustomization.yaml": "commonLabels:\n  team: storage\npatches:\n  - path: resources.yaml\nresources:\n  - extra.yaml\n",
+		"extra.yaml":         "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: extra\n",
+		"resources.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: __KRO_NAME__-controller
+  namespace: __KRO_NAMESPACE__
+spec:
+  template:
+    spec:
+      containers:
+        - name: controller
+          resources:
+            limits:
+              memory: 256Mi
+`,
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := RenderChart(context.Background(), "testdata/dummychart", config.GraphSpec{
+		Service:        "dummy",
+		ReleaseName:    "__KRO_NAME__",
+		Image:          config.ImageSpec{Repository: "__KRO_IMAGE_REPOSITORY__", Tag: "__KRO_IMAGE_TAG__"},
+		ServiceAccount: config.SASpec{Name: "__KRO_SA_NAME__"},
+		Controller:     config.ControllerSpec{LogLevel: "__KRO_LOG_LEVEL__"},
+		Kustomize:      dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Objects stay under the template they were rendered from.
+	body := res.RenderedFiles["dummy/templates/deployment.yaml"]
+	for _, want := range []string{"team: storage", "memory: 256Mi", "name: __KRO_NAME__-controller", "__KRO_IMAGE_REPOSITORY__:__KRO_IMAGE_TAG__", "__KRO_LOG_LEVEL__"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("kustomize output missing %q:\n%s", want, body)
+		}
+	}
+	if !strings.Contains(res.RenderedFiles[KustomizedFile], "name: extra") {
+		t.Errorf("kustomization's own resources not under %s: %v", KustomizedFile, SortedKeys(res.RenderedFiles))
+	}
+	if len(res.CRDs) != 1 || res.CRDs[KustomizedFile] != "" {
+		t.Errorf("CRDs not kept under their files: %v", SortedKeys(res.CRDs))
+	}
+	for name, body := range res.RenderedFiles {
+		if strings.Contains(body, sourceAnnotation) {
+			t.Errorf("%s keeps the %s annotation", name, sourceAnnotation)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, renderedResource)); !os.IsNotExist(err) {
+		t.Errorf("rendered resources written to the kustomization dir: %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/strvals"
+)
+
+// Value sources reported by ExplainValues for layers that are not files.
+const (
+	SourceChart     = "chart values.yaml"
+	SourceGraphSpec = "graph spec"
+)
+
+// ValueSource is one leaf of the final chart values and the layer that set it.
+type ValueSource struct {
+	Path   string
+	Value  any
+	Source string
+}
+
+// valuesLayer is one source of chart values. Layers are merged in order, so
+// later layers win.
+type valuesLayer struct {
+	source string
+	values map[string]any
+}
+
+// valueLayers lists the value sources for gs from lowest to highest precedence:
+//  1. graph spec fields (image, serviceAccount, log flags, AWS region)
+//  2. valuesFiles, in order, like `helm -f`
+//  3. extras.values["<service>-chart"] (e.g. "s3-chart")
+//  4. extras.values["ack-chart"] (shared across ACK controllers)
+//  5. extras.values top-level keys other than the chart overlays above
+//  6. set entries (`--set` syntax), in order
+//
+// Chart defaults from values.yaml sit beneath all of them.
+func valueLayers(gs config.GraphSpec) ([]valuesLayer, error) {
+	// Base values seeded from GraphSpec.
+	base := map[string]any{
+		"image": map[string]any{
+			"repository": gs.Image.Repository,
+			"tag":        gs.Image.Tag,
+		},
+		"serviceAccount": map[string]any{
+			"name": gs.ServiceAccount.Name,
+		},
+		"logLevel": gs.Controller.LogLevel,
+		"logDev":   gs.Controller.LogDev,
+		"aws": map[string]any{
+			"region": gs.AWS.Region,
+		},
+	}
+	// If annotations are provided in GraphSpec, copy them into the base map.
+	if len(gs.ServiceAccount.Annotations) > 0 {
+		ann := make(map[string]any, len(gs.ServiceAccount.Annotations))
+		for k, v := range gs.ServiceAccount.Annotations {
+			ann[k] = v
+		}
+		base["serviceAccount"].(map[string]any)["annotations"] = ann
+	}
+	layers := []valuesLayer{{source: SourceGraphSpec, values: base}}
+
+	for _, f := range gs.ValuesFiles {
+		vals, err := chartutil.ReadValuesFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("values file %s: %w", f, err)
+		}
+		layers = append(layers, valuesLayer{source: f, values: vals.AsMap()})
+	}
+
+	if gs.Extras.Values != nil {
+		svcKey := gs.Service + "-chart"
+		for _, key := range []string{svcKey, "ack-chart"} {
+			if mv, ok := gs.Extras.Values[key].(map[string]any); ok {
+				layers = append(layers, valuesLayer{source: "extras.values." + key, values: mv})
+			}
+		}
+		rest := map[string]any{}
+		for k, v := range gs.Extras.Values {
+			if k != svcKey && k != "ack-chart" {
+				rest[k] = v
+			}
+		}
+		if len(rest) > 0 {
+			layers = append(layers, valuesLayer{source: "extras.values", values: rest})
+		}
+	}
+
+	for _, s := range gs.Set {
+		vals := map[string]any{}
+		if err := strvals.ParseInto(s, vals); err != nil {
+			return nil, fmt.Errorf("set %q: %w", s, err)
+		}
+		layers = append(layers, valuesLayer{source: "set " + s, values: vals})
+	}
+	return layers, nil
+}
+
+// buildValues merges the layers from valueLayers into the Helm values map and
+// returns, alongside it, the source of every leaf path it set.
+func buildValues(gs config.GraphSpec) (map[string]any, map[string]string, error) {
+	layers, err := valueLayers(gs)
+	if err != nil {
+		return nil, nil, err
+	}
+	base := map[string]any{}
+	origins := map[string]string{}
+	for _, l := range layers {
+		mergeTracked(base, l.values, nil, l.source, origins)
+	}
+
+	// Normalize serviceAccount type:
+	// If a chart expects serviceAccount to be a map, but a string name is supplied,
+	// convert the string form into a structured map with create:false and empty annotations.
+	if name, ok := base["serviceAccount"].(string); ok {
+		base["serviceAccount"] = map[string]any{
+			"create":      false,
+			"name":        name,
+			"annotations": map[string]any{},
+		}
+	}
+
+	// Ensure serviceAccount is a map and annotations is map[string]any.
+	sa, ok := base["serviceAccount"].(map[string]any)
+	if !ok {
+		sa = map[string]any{}
+		if gs.ServiceAccount.Name != "" {
+			sa["name"] = gs.ServiceAccount.Name
+		}
+	}
+	base["serviceAccount"] = sa
+
+	switch a := sa["annotations"].(type) {
+	case map[string]any:
+		// already correct
+	case map[string]string:
+		// copy into map[string]any for consistent types in templates.
+		m := make(map[string]any, len(a))
+		for k, v := range a {
+			m[k] = v
+		}
+		sa["annotations"] = m
+	default:
+		// ensure non-nil map
+		sa["annotations"] = map[string]any{}
+	}
+
+	return base, origins, nil
+}
+
+// ExplainValues loads the chart and returns every leaf of the values Helm will
+// render with, sorted by path, along with the layer that set it. Leaves not
+// set by any layer come from the chart's values.yaml. It returns ctx.Err() if
+// ctx is done before the chart is loaded.
+func ExplainValues(ctx context.Context, chartArchivePath string, gs config.GraphSpec) ([]ValueSource, error) {
+	ch, err := LoadChart(ctx, chartArchivePath)
+	if err != nil {
+		return nil, err
+	}
+	gs.ApplyChartDefaults(ch.Metadata.AppVersion)
+	vals, origins, err := buildValues(gs)
+	if err != nil {
+		return nil, err
+	}
+	final, err := chartutil.CoalesceValues(ch, vals)
+	if err != nil {
+		return nil, fmt.Errorf("coalesce values: %w", err)
+	}
+
+	leaves := map[string]any{}
+	flattenValues(nil, final.AsMap(), leaves)
+	out := make([]ValueSource, 0, len(leaves))
+	for path, v := range leaves {
+		src := SourceChart
+		for p := path; p != ""; p = parentPath(p) {
+			if o, ok := origins[p]; ok {
+				src = o
+				break
+			}
+		}
+		out = append(out, ValueSource{Path: path, Value: v, Source: src})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out, nil
+}
+
+// FormatValue renders a leaf value as compact JSON for display.
+func FormatValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// mergeTracked merges src into dst like deepMerge and records in origins the
+// source of each leaf path it writes. Replacing a subtree drops the origins
+// recorded beneath it.
+func mergeTracked(dst, src map[string]any, prefix []string, source string, origins map[string]string) {
+	for k, v := range src {
+		path := append(append([]string{}, prefix...), k)
+		key := strings.Join(path, ".")
+		if vmap, ok := v.(map[string]any); ok {
+			if dmap, ok := dst[k].(map[string]any); ok {
+				mergeTracked(dmap, vmap, path, source, origins)
+				continue
+			}
+			dropOrigins(origins, key)
+			dst[k] = map[string]any{}
+			mergeTracked(dst[k].(map[string]any), vmap, path, source, origins)
+			if len(vmap) == 0 {
+				origins[key] = source
+			}
+			continue
+		}
+		dropOrigins(origins, key)
+		dst[k] = v
+		origins[key] = source
+	}
+}
+
+func dropOrigins(origins map[string]string, key string) {
+	delete(origins, key)
+	for p := range origins {
+		if strings.HasPrefix(p, key+".") {
+			delete(origins, p)
+		}
+	}
+}
+
+func flattenValues(prefix []string, v any, out map[string]any) {
+	if m, ok := v.(map[string]any); ok && len(m) > 0 {
+		for k, child := range m {
+			flattenValues(append(append([]string{}, prefix...), k), child, out)
+		}
+		return
+	}
+	if len(prefix) > 0 {
+		out[strings.Join(prefix, ".")] = v
+	}
+}
+
+func parentPath(p string) string {
+	if i := strings.LastIndex(p, "."); i >= 0 {
+		return p[:i]
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package render
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+)
+
+func TestExplainValuesPrecedence(t *testing.T) {
+	vf := filepath.Join(t.TempDir(), "values.yaml")
+	if err := os.WriteFile(vf, []byte("logLevel: warn\naws:\n  region: eu-west-1\nextra: from-file\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gs := config.GraphSpec{
+		Service:     "dummy",
+		Version:     "0.1.0",
+		AWS:         config.AWSSpec{Region: "us-west-2"},
+		ValuesFiles: []string{vf},
+		Extras: config.ExtrasSpec{Values: map[string]any{
+			"logDev":      "true",
+			"ack-chart":   map[string]any{"logDev": "false", "image": map[string]any{"tag": "shared"}},
+			"dummy-chart": map[string]any{"logLevel": "debug", "image": map[string]any{"tag": "svc"}},
+		}},
+		Set: []string{"aws.region=ap-south-1"},
+	}
+	vals, err := ExplainValues(context.Background(), "testdata/dummychart", gs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]ValueSource{}
+	for _, v := range vals {
+		got[v.Path] = v
+	}
+	want := map[string][2]string{
+		"logLevel":   {"debug", "extras.values.dummy-chart"},
+		"aws.region": {"ap-south-1", "set aws.region=ap-south-1"},
+		"extra":      {"from-file", vf},
+		"logDev":     {"true", "extras.values"},
+		"image.tag":  {"shared", "extras.values.ack-chart"},
+		// Graph spec fields override chart defaults even when empty.
+		"image.repository":    {"", SourceGraphSpec},
+		"serviceAccount.name": {"", SourceGraphSpec},
+	}
+	for path, w := range want {
+		v, ok := got[path]
+		if !ok {
+			t.Fatalf("missing %s", path)
+		}
+		if v.Value != w[0] || v.Source != w[1] {
+			t.Errorf("%s = %v from %q, want %v from %q", path, v.Value, v.Source, w[0], w[1])
+		}
+	}
+}
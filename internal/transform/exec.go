@@ -0,0 +1,56 @@
+package transform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+	"github.com/jayadeyemi/ack-kro-gen/internal/util"
+)
+
+// execPlugin pipes every object through an external program as multi-document
+// YAML on stdin and reads the replacement set from its stdout. A non-zero exit
+// fails the run with the program's stderr.
+type execPlugin struct {
+	command []string
+}
+
+func (e *execPlugin) Name() string { return "exec " + e.command[0] }
+
+func (e *execPlugin) Transform(ctx context.Context, objs []classify.Obj) ([]classify.Obj, error) {
+	var in bytes.Buffer
+	for i, o := range objs {
+		if i > 0 {
+			in.WriteString("---\n")
+		}
+		y, err := o.YAML()
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s from %s: %w", o.Kind, o.Name, o.Source, err)
+		}
+		in.WriteString(y)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.command[0], e.command[1:]...)
+	cmd.Stdin = &in
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	var out []classify.Obj
+	for _, doc := range util.SplitDocs(stdout.String()) {
+		o, err := classify.ParseDoc(e.Name()+" output", doc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, nil
+}
@@ -0,0 +1,90 @@
+package transform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+)
+
+// json6902 applies an RFC 6902 JSON patch to every target.
+type json6902 struct {
+	target target
+	patch  jsonpatch.Patch
+}
+
+func newJSON6902(spec config.TransformerSpec) (*json6902, error) {
+	if spec.Target == (config.TargetSpec{}) {
+		return nil, fmt.Errorf("json6902: target is required")
+	}
+	src, err := patchSource(spec)
+	if err != nil {
+		return nil, err
+	}
+	p, err := jsonpatch.DecodePatch(src)
+	if err != nil {
+		return nil, fmt.Errorf("json6902: %w", err)
+	}
+	return &json6902{target: target(spec.Target), patch: p}, nil
+}
+
+func (j *json6902) Name() string { return "json6902 " + j.target.String() }
+
+func (j *json6902) Transform(_ context.Context, objs []classify.Obj) ([]classify.Obj, error) {
+	return patchMatching(j.target, objs, func(_ classify.Obj, doc []byte) ([]byte, error) {
+		return j.patch.Apply(doc)
+	})
+}
+
+// strategicMerge applies a strategic merge patch to every target. Kinds the
+// built-in Kubernetes scheme does not know, such as ACK custom resources,
+// have no merge strategy and get a JSON merge patch (RFC 7386) instead.
+type strategicMerge struct {
+	target target
+	patch  []byte
+}
+
+func newStrategicMerge(spec config.TransformerSpec) (*strategicMerge, error) {
+	src, err := patchSource(spec)
+	if err != nil {
+		return nil, err
+	}
+	t := target(spec.Target)
+	if t == (target{}) {
+		// Like kustomize, an untargeted patch applies to the object it names.
+		var head struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		}
+		if err := json.Unmarshal(src, &head); err != nil {
+			return nil, fmt.Errorf("strategicMerge: %w", err)
+		}
+		if head.Kind == "" {
+			return nil, fmt.Errorf("strategicMerge: patch has no kind; set target")
+		}
+		t = target{APIVersion: head.APIVersion, Kind: head.Kind, Name: head.Metadata.Name}
+	}
+	return &strategicMerge{target: t, patch: src}, nil
+}
+
+func (s *strategicMerge) Name() string { return "strategicMerge " + s.target.String() }
+
+func (s *strategicMerge) Transform(_ context.Context, objs []classify.Obj) ([]classify.Obj, error) {
+	return patchMatching(s.target, objs, func(o classify.Obj, doc []byte) ([]byte, error) {
+		typed, err := scheme.Scheme.New(schema.FromAPIVersionAndKind(o.APIVersion, o.Kind))
+		if err != nil {
+			return jsonpatch.MergePatch(doc, s.patch)
+		}
+		return strategicpatch.StrategicMergePatch(doc, s.patch, typed)
+	})
+}
@@ -0,0 +1,159 @@
+// Package transform applies the patches and plugins configured under a graph's
+// transformers to rendered objects, after classification and before they are
+// converted to KRO resources.
+package transform
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+	"sigs.k8s.io/yaml"
+)
+
+// Transformer rewrites a set of rendered objects. It may modify, add or
+// remove objects; the returned slice replaces the input.
+type Transformer interface {
+	// Name identifies the transformer in logs and errors.
+	Name() string
+	Transform(ctx context.Context, objs []classify.Obj) ([]classify.Obj, error)
+}
+
+// New builds the transformer described by spec, reading its patch file if it has one.
+func New(spec config.TransformerSpec) (Transformer, error) {
+	switch spec.Type {
+	case config.TransformerJSON6902:
+		return newJSON6902(spec)
+	case config.TransformerStrategicMerge:
+		return newStrategicMerge(spec)
+	case config.TransformerExec:
+		if len(spec.Command) == 0 {
+			return nil, fmt.Errorf("exec: command is required")
+		}
+		return &execPlugin{command: spec.Command}, nil
+	}
+	return nil, fmt.Errorf("unknown transformer type %q", spec.Type)
+}
+
+// FromConfig builds the transformers for specs, in order.
+func FromConfig(specs []config.TransformerSpec) ([]Transformer, error) {
+	out := make([]Transformer, 0, len(specs))
+	for i, s := range specs {
+		t, err := New(s)
+		if err != nil {
+			return nil, fmt.Errorf("transformers[%d]: %w", i, err)
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// Apply runs ts over objs in order, feeding each the output of the previous one.
+func Apply(ctx context.Context, service string, ts []Transformer, objs []classify.Obj) ([]classify.Obj, error) {
+	for i, t := range ts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		out, err := t.Transform(ctx, objs)
+		if err != nil {
+			return nil, fmt.Errorf("transformers[%d] %s: %w", i, t.Name(), err)
+		}
+		log.Printf("[%s] transform: %s in=%d out=%d", service, t.Name(), len(objs), len(out))
+		objs = out
+	}
+	return objs, nil
+}
+
+// patchSource returns the patch text of spec, from Patch or the file at Path, as JSON.
+func patchSource(spec config.TransformerSpec) ([]byte, error) {
+	src := []byte(spec.Patch)
+	if spec.Path != "" {
+		b, err := os.ReadFile(spec.Path)
+		if err != nil {
+			return nil, fmt.Errorf("read patch: %w", err)
+		}
+		src = b
+	}
+	if strings.TrimSpace(string(src)) == "" {
+		return nil, fmt.Errorf("%s: patch or path is required", spec.Type)
+	}
+	j, err := yaml.YAMLToJSON(src)
+	if err != nil {
+		return nil, fmt.Errorf("decode patch: %w", err)
+	}
+	return j, nil
+}
+
+// target selects objects by apiVersion, kind and a glob over the name.
+type target config.TargetSpec
+
+func (t target) matches(o classify.Obj) bool {
+	if t.APIVersion != "" && t.APIVersion != o.APIVersion {
+		return false
+	}
+	if t.Kind != "" && t.Kind != o.Kind {
+		return false
+	}
+	if t.Name != "" {
+		ok, _ := path.Match(t.Name, o.Name)
+		return ok
+	}
+	return true
+}
+
+func (t target) String() string {
+	kind := t.Kind
+	if kind == "" {
+		kind = "*"
+	}
+	if t.Name == "" {
+		return kind
+	}
+	return kind + "/" + t.Name
+}
+
+// patchMatching applies fn to the JSON form of every object t matches and
+// re-parses the result. It fails if nothing matched, so a typo in a target
+// does not go unnoticed.
+func patchMatching(t target, objs []classify.Obj, fn func(o classify.Obj, doc []byte) ([]byte, error)) ([]classify.Obj, error) {
+	out := make([]classify.Obj, 0, len(objs))
+	matched := 0
+	for _, o := range objs {
+		if !t.matches(o) {
+			out = append(out, o)
+			continue
+		}
+		matched++
+		src, err := o.YAML()
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s from %s: %w", o.Kind, o.Name, o.Source, err)
+		}
+		doc, err := yaml.YAMLToJSON([]byte(src))
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s from %s: %w", o.Kind, o.Name, o.Source, err)
+		}
+		patched, err := fn(o, doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s from %s: %w", o.Kind, o.Name, o.Source, err)
+		}
+		y, err := yaml.JSONToYAML(patched)
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s from %s: %w", o.Kind, o.Name, o.Source, err)
+		}
+		p, err := classify.Parse(string(y))
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s from %s: patched object: %w", o.Kind, o.Name, o.Source, err)
+		}
+		p.Source = o.Source
+		out = append(out, p)
+	}
+	if matched == 0 {
+		return nil, fmt.Errorf("target %s matched no objects", t)
+	}
+	return out, nil
+}
@@ -0,0 +1,126 @@
+package transform
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/jayadeyemi/ack-kro-gen/internal/classify"
+	"github.com/jayadeyemi/ack-kro-gen/internal/config"
+)
+
+const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: __KRO_NAME__-controller
+  namespace: __KRO_NAMESPACE__
+spec:
+  template:
+    spec:
+      containers:
+        - name: controller
+          image: public.ecr.aws/aws-controllers-k8s/s3-controller:_IMAGE_TAG_
+`
+
+func parse(t *testing.T, docs ...string) []classify.Obj {
+	t.Helper()
+	var out []classify.Obj
+	for _, d := range docs {
+		o, err := classify.Parse(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, o)
+	}
+	return out
+}
+
+func text(t *testing.T, o classify.Obj) string {
+	t.Helper()
+	s, err := o.YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func run(t *testing.T, spec config.TransformerSpec, objs []classify.Obj) []classify.Obj {
+	t.Helper()
+	tr, err := New(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Apply(context.Background(), "s3", []Transformer{tr}, objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestStrategicMergeAddsSidecar(t *testing.T) {
+	objs := parse(t, deployment, "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: sa\n")
+	out := run(t, config.TransformerSpec{
+		Type:   config.TransformerStrategicMerge,
+		Target: config.TargetSpec{Kind: "Deployment", Name: "*-controller"},
+		Patch: `spec:
+  template:
+    spec:
+      securityContext:
+        runAsNonRoot: true
+      containers:
+        - name: proxy
+          image: envoy:v1
+`,
+	}, objs)
+	got := text(t, out[0])
+	for _, want := range []string{"name: controller", "name: proxy", "runAsNonRoot: true", "_IMAGE_TAG_", "__KRO_NAME__-controller"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("patched deployment missing %q:\n%s", want, got)
+		}
+	}
+	if out[1].Node != objs[1].Node {
+		t.Errorf("untargeted object changed:\n%s", text(t, out[1]))
+	}
+}
+
+func TestJSON6902RewritesImage(t *testing.T) {
+	out := run(t, config.TransformerSpec{
+		Type:   config.TransformerJSON6902,
+		Target: config.TargetSpec{Kind: "Deployment"},
+		Patch:  `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "registry.example.com/s3-controller:_IMAGE_TAG_"}]`,
+	}, parse(t, deployment))
+	if got := text(t, out[0]); !strings.Contains(got, "image: registry.example.com/s3-controller:_IMAGE_TAG_") {
+		t.Errorf("image not rewritten:\n%s", got)
+	}
+}
+
+func TestTargetMustMatch(t *testing.T) {
+	tr, err := New(config.TransformerSpec{
+		Type:   config.TransformerJSON6902,
+		Target: config.TargetSpec{Kind: "StatefulSet"},
+		Patch:  `[{"op": "remove", "path": "/spec"}]`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.Transform(context.Background(), parse(t, deployment)); err == nil || !strings.Contains(err.Error(), "matched no objects") {
+		t.Fatalf("err = %v, want no match error", err)
+	}
+}
+
+func TestExecPlugin(t *testing.T) {
+	if _, err := exec.LookPath("sed"); err != nil {
+		t.Skip("sed not available")
+	}
+	out := run(t, config.TransformerSpec{
+		Type:    config.TransformerExec,
+		Command: []string{"sed", "s#public.ecr.aws#mirror.example.com#"},
+	}, parse(t, deployment, "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: sa\n"))
+	if len(out) != 2 || out[1].Kind != "ServiceAccount" {
+		t.Fatalf("got %d objects, want deployment and service account", len(out))
+	}
+	if got := text(t, out[0]); !strings.Contains(got, "mirror.example.com/aws-controllers-k8s") {
+		t.Errorf("plugin output not used:\n%s", got)
+	}
+}
@@ -0,0 +1,20 @@
+package util
+
+import "context"
+
+// Await runs fn in a goroutine and returns its error, or ctx.Err() as soon as
+// ctx is done. It is meant for library calls that take no context: fn keeps
+// running in the background after an early return, and its result is dropped.
+func Await(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
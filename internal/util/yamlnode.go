@@ -0,0 +1,41 @@
+package util
+
+import "gopkg.in/yaml.v3"
+
+// MappingIndex returns the index of key within mapping node m's Content, or
+// -1 if m is nil, not a mapping, or has no such key.
+func MappingIndex(m *yaml.Node, key string) int {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// MappingValue returns the value stored under key in mapping node m, or nil.
+func MappingValue(m *yaml.Node, key string) *yaml.Node {
+	if i := MappingIndex(m, key); i >= 0 {
+		return m.Content[i+1]
+	}
+	return nil
+}
+
+// CloneNode returns a deep copy of n, or nil if n is nil. Alias nodes are
+// copied as they are and still point at the original anchored node.
+func CloneNode(n *yaml.Node) *yaml.Node {
+	if n == nil {
+		return nil
+	}
+	c := *n
+	if n.Content != nil {
+		c.Content = make([]*yaml.Node, len(n.Content))
+		for i, child := range n.Content {
+			c.Content[i] = CloneNode(child)
+		}
+	}
+	return &c
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMappingValue(t *testing.T) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte("a: 1\nb: [x]\n"), &doc); err != nil {
+		t.Fatal(err)
+	}
+	m := doc.Content[0]
+	if v := MappingValue(m, "a"); v == nil || v.Value != "1" {
+		t.Fatalf("a = %v", v)
+	}
+	if MappingIndex(m, "b") != 2 || MappingIndex(m, "c") != -1 {
+		t.Fatalf("indexes b=%d c=%d", MappingIndex(m, "b"), MappingIndex(m, "c"))
+	}
+	if MappingValue(nil, "a") != nil || MappingValue(MappingValue(m, "b"), "x") != nil {
+		t.Fatal("lookups in nil or non-mapping nodes should return nil")
+	}
+}
+
+func TestCloneNode(t *testing.T) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte("a: {b: [x]}\n"), &doc); err != nil {
+		t.Fatal(err)
+	}
+	c := CloneNode(&doc)
+	MappingValue(MappingValue(c.Content[0], "a"), "b").Content[0].Value = "y"
+	if got := MappingValue(MappingValue(doc.Content[0], "a"), "b").Content[0].Value; got != "x" {
+		t.Fatalf("original changed to %q", got)
+	}
+	if CloneNode(nil) != nil {
+		t.Fatal("CloneNode(nil) should be nil")
+	}
+}
@@ -1,16 +1,162 @@
 package util
 
-import "strings"
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Doc is one document of a multi-document YAML stream.
+type Doc struct {
+	// Index counts the non-empty documents before this one in the stream.
+	Index int
+	// Line is the 1-based line of the stream where Text starts.
+	Line int
+	// Offset is the byte offset in the stream where Text starts.
+	Offset int
+	// Text is the document source without its bare --- and ... marker lines.
+	Text string
+	// Node is the decoded document, with line numbers relative to the whole
+	// stream. It is nil when the stream failed to parse at or before it.
+	Node *yaml.Node
+}
+
+var (
+	// startMarker matches a --- line with nothing after it but a comment.
+	startMarker = regexp.MustCompile(`^---[ \t]*(#.*)?$`)
+	// docStart matches any line that begins a document.
+	docStart = regexp.MustCompile(`^---([ \t].*)?\r?$`)
+	// endMarker matches a ... document end line.
+	endMarker = regexp.MustCompile(`^\.\.\.([ \t].*)?$`)
+)
+
+// SplitDocs splits a YAML stream into its documents. Boundaries come from a
+// streaming yaml.Decoder, so --- inside block scalars, markers followed by
+// comments, ... end markers and a leading --- are all handled the way YAML
+// parsers read them. Documents holding nothing but comments are dropped.
+//
+// If the stream does not parse, the rest of it is split on --- lines at column
+// zero, which is where a YAML parser would start new documents, so decoding
+// each one again reports the error against the right document.
+func SplitDocs(s string) []Doc {
+	lineStarts := []int{0}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	offset := func(line int) int {
+		if line-1 < len(lineStarts) {
+			return lineStarts[line-1]
+		}
+		return len(s)
+	}
+
+	type span struct {
+		line  int
+		empty bool
+		node  *yaml.Node
+	}
+	var spans []span
+	dec := yaml.NewDecoder(strings.NewReader(s))
+	for {
+		var n yaml.Node
+		err := dec.Decode(&n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The decoder may fail before returning documents it has already
+			// scanned past, so split the rest on marker lines instead.
+			from := 1
+			if len(spans) > 0 {
+				from = spans[len(spans)-1].line
+				spans = spans[:len(spans)-1]
+			}
+			for i, line := range strings.Split(s[offset(from):], "\n") {
+				if i == 0 || docStart.MatchString(line) {
+					spans = append(spans, span{line: from + i})
+				}
+			}
+			break
+		}
+		// A document node starts at its --- marker, or at its content when it has none.
+		spans = append(spans, span{line: n.Line, empty: emptyDoc(&n), node: &n})
+	}
+	if len(spans) > 0 {
+		// Comments before the first document belong to it.
+		spans[0].line = 1
+	}
+
+	var docs []Doc
+	for i, sp := range spans {
+		if sp.empty {
+			continue
+		}
+		end := len(s)
+		if i+1 < len(spans) {
+			end = offset(spans[i+1].line)
+		}
+		d := trimMarkers(Doc{Index: len(docs), Line: sp.line, Offset: offset(sp.line), Text: s[offset(sp.line):end], Node: sp.node})
+		if commentsOnly(d.Text) {
+			continue
+		}
+		docs = append(docs, d)
+	}
+	return docs
+}
 
 // SplitYAML splits a YAML multi-document string into individual docs, trimming empties.
 func SplitYAML(s string) []string {
-	parts := []string{}
-	for _, p := range strings.Split(s, "\n---") {
-		t := strings.TrimSpace(p)
-		if t == "" { continue }
+	docs := SplitDocs(s)
+	parts := make([]string, 0, len(docs))
+	for _, d := range docs {
 		// Ensure trailing newline for deterministic encoding later
-		if !strings.HasSuffix(t, "\n") { t += "\n" }
-		parts = append(parts, t)
+		parts = append(parts, strings.TrimSpace(d.Text)+"\n")
 	}
 	return parts
-}
\ No newline at end of file
+}
+
+func commentsOnly(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if l := strings.TrimSpace(line); l != "" && !strings.HasPrefix(l, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+func emptyDoc(n *yaml.Node) bool {
+	if len(n.Content) == 0 {
+		return true
+	}
+	c := n.Content[0]
+	return c.Kind == yaml.ScalarNode && c.ShortTag() == "!!null"
+}
+
+// trimMarkers drops a leading bare --- line and trailing ... lines from d.Text,
+// moving Line and Offset past what it removed.
+func trimMarkers(d Doc) Doc {
+	for {
+		line, rest, ok := strings.Cut(d.Text, "\n")
+		if !startMarker.MatchString(strings.TrimRight(line, "\r")) && strings.TrimSpace(line) != "" {
+			break
+		}
+		if !ok {
+			d.Offset += len(d.Text)
+			d.Text = ""
+			return d
+		}
+		d.Text = rest
+		d.Offset += len(line) + 1
+		d.Line++
+	}
+	lines := strings.Split(strings.TrimRight(d.Text, "\n"), "\n")
+	for len(lines) > 0 && endMarker.MatchString(strings.TrimRight(lines[len(lines)-1], "\r")) {
+		lines = lines[:len(lines)-1]
+	}
+	d.Text = strings.Join(lines, "\n") + "\n"
+	return d
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitDocs(t *testing.T) {
+	src := `--- # leading marker with a comment
+# Source: chart/templates/cm.yaml
+kind: ConfigMap
+data:
+  script: |
+    echo start
+---
+    echo still in the scalar? no, a new document
+...
+---
+# only a comment
+--- |
+  literal document
+---
+kind: Secret
+stringData:
+  pem: |
+    -----BEGIN CERTIFICATE-----
+    ---
+    -----END CERTIFICATE-----
+...
+`
+	got := SplitDocs(src)
+	type doc struct {
+		Index, Line int
+		Text        string
+	}
+	want := []doc{
+		{0, 2, "# Source: chart/templates/cm.yaml\nkind: ConfigMap\ndata:\n  script: |\n    echo start\n"},
+		{1, 8, "    echo still in the scalar? no, a new document\n"},
+		{2, 12, "--- |\n  literal document\n"},
+		{3, 15, "kind: Secret\nstringData:\n  pem: |\n    -----BEGIN CERTIFICATE-----\n    ---\n    -----END CERTIFICATE-----\n"},
+	}
+	var have []doc
+	for _, d := range got {
+		have = append(have, doc{d.Index, d.Line, d.Text})
+		if src[d.Offset:d.Offset+len(d.Text)] != d.Text {
+			t.Errorf("doc %d: offset %d does not point at its text", d.Index, d.Offset)
+		}
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("SplitDocs:\n got  %q\n want %q", have, want)
+	}
+}
+
+func TestSplitDocsKeepsUnparsableRest(t *testing.T) {
+	docs := SplitDocs("a: 1\n---\nb: [1\n---\nc: 3\n")
+	if len(docs) != 3 || docs[1].Line != 3 || docs[1].Text != "b: [1\n" {
+		t.Fatalf("got %+v, want the bad document on its own from line 3", docs)
+	}
+}